@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+
+	"github.com/appleboy/resize-tool/resize"
 )
 
 /*
 processBatch processes all supported image files in the specified directory using a worker pool.
 It collects image files, distributes them to worker goroutines, and prints a summary of results.
 */
-func processBatch(dirPath string) {
+func processBatch(ctx context.Context, dirPath string) batchSummary {
 	if verbose {
 		fmt.Printf("Processing directory: %s\n", dirPath)
 	}
@@ -24,46 +32,194 @@ func processBatch(dirPath string) {
 		os.Exit(1)
 	}
 
+	imageFiles = excludeGenerated(dirPath, imageFiles)
+
 	if len(imageFiles) == 0 {
 		fmt.Println("No image files found in directory")
-		return
+		return batchSummary{}
+	}
+
+	return runWorkerPool(ctx, dirPath, imageFiles)
+}
+
+// batchSummary counts the outcomes of a run over one or more files.
+type batchSummary struct {
+	total       int  // Files handed to the run
+	success     int  // Files resized successfully
+	errors      int  // Files that failed
+	skipped     int  // Files left out by --skip-existing, --incremental or a size guard
+	canceled    int  // Files not processed because the run was stopped early
+	interrupted bool // Whether the run was stopped by Ctrl-C
+}
+
+/*
+errorPolicy is the parsed --allow-errors value: the number, or with percent
+set the percentage, of failed files a run may have and still exit 0.
+*/
+type errorPolicy struct {
+	limit   float64
+	percent bool
+}
+
+// parseErrorPolicy parses an --allow-errors value such as "3" or "5%".
+func parseErrorPolicy(s string) (errorPolicy, error) {
+	value, percent := strings.CutSuffix(strings.TrimSpace(s), "%")
+	limit, err := strconv.ParseFloat(value, 64)
+	// Counts must be whole numbers, percentages at most 100
+	valid := err == nil && limit >= 0 &&
+		(percent && limit <= 100 || !percent && limit == float64(int(limit)))
+	if !valid {
+		return errorPolicy{}, fmt.Errorf(
+			"invalid --allow-errors value %q (use a file count like 3 or a percentage like 5%%)",
+			s,
+		)
+	}
+	return errorPolicy{limit: limit, percent: percent}, nil
+}
+
+// allows reports whether failed errors out of total files are within the policy.
+func (p errorPolicy) allows(failed, total int) bool {
+	if p.percent {
+		return float64(failed)*100 <= p.limit*float64(total)
+	}
+	return float64(failed) <= p.limit
+}
+
+// String returns the policy in --allow-errors syntax.
+func (p errorPolicy) String() string {
+	s := strconv.FormatFloat(p.limit, 'f', -1, 64)
+	if p.percent {
+		s += "%"
 	}
+	return s
+}
 
-	runWorkerPool(imageFiles)
+/*
+checkErrors exits with a non-zero status if the run had more failed files than
+--allow-errors permits, was stopped early by --fail-fast or was interrupted.
+*/
+func checkErrors(summary batchSummary) {
+	if summary.interrupted {
+		slog.Error(fmt.Sprintf("Interrupted, %d files were not processed", summary.canceled))
+		// 128 + SIGINT, as shells report a process killed by Ctrl-C
+		os.Exit(130)
+	}
+	if summary.canceled > 0 {
+		slog.Error(fmt.Sprintf(
+			"Stopped after %d failed files, %d files were not processed",
+			summary.errors, summary.canceled,
+		))
+		os.Exit(1)
+	}
+	// Skipped files were never attempted, so they do not count towards a percentage
+	processed := summary.total - summary.skipped
+	if !allowErrors.allows(summary.errors, processed) {
+		slog.Error(fmt.Sprintf(
+			"%d of %d processed files failed (allowed: %s)",
+			summary.errors, processed, allowErrors,
+		))
+		os.Exit(1)
+	}
 }
 
 /*
 runWorkerPool resizes the given image files concurrently using a pool of worker
-goroutines and prints a summary of the results.
+goroutines, prints a summary of the results and writes the report if requested.
+With --output, the directory tree below root is mirrored in the output
+directory, and the run is refused if two files would still get the same output.
+Files that --skip-existing or --incremental find up to date are not handed to
+the workers; they and the files left alone by a size guard such as
+--no-upscale are counted as skipped.
+With --fail-fast, the pool stops handing out jobs as soon as the failures
+exceed --allow-errors. When ctx is canceled (Ctrl-C) it stops handing out jobs
+too, and files in flight either finish or are abandoned before anything is
+written. Files that were not completed are counted as canceled.
 */
-func runWorkerPool(files []string) {
+func runWorkerPool(parent context.Context, root string, files []string) batchSummary {
 	fmt.Printf("Found %d image files\n", len(files))
 
+	resizer, err := newResizer(root)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if dryRun {
+		return planRun(resizer, files)
+	}
+
+	// Leave out files --skip-existing or --incremental consider up to date
+	skip, err := newSkipper(resizer)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	records := make([]fileResult, len(files))
+	summary := batchSummary{total: len(files)}
+	var pending []int
+	for i, path := range files {
+		if reason := skip.reason(path); reason != "" {
+			records[i] = fileResult{path: path, skipped: reason}
+			summary.skipped++
+			continue
+		}
+		pending = append(pending, i)
+	}
+	if summary.skipped > 0 {
+		fmt.Printf("Skipping %d up-to-date files\n", summary.skipped)
+	}
+
+	// Refuse to start if two inputs would write the same output file
+	pendingFiles := make([]string, len(pending))
+	for j, i := range pending {
+		pendingFiles[j] = files[i]
+	}
+	refuseCollisions(resizer, pendingFiles)
+
 	// Never start more workers than there are files to process.
-	workerCount := min(workers, len(files))
+	workerCount := min(workers, len(pending))
 	if verbose {
 		fmt.Printf("Using %d workers\n", workerCount)
 	}
 
-	// Create channels for jobs and results for the worker pool
-	jobs := make(chan string, len(files))
-	results := make(chan error, len(files))
+	// Canceling ctx stops the dispatch of further jobs (--fail-fast or Ctrl-C)
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	// Create channels for jobs and results for the worker pool. Jobs carry the
+	// file index so results can be reported in input order. The jobs channel
+	// is unbuffered so that no work is queued up once the pool is canceled.
+	jobs := make(chan int)
+	results := make(chan indexedResult, len(pending))
 
 	// Start worker goroutines to process images concurrently
+	var failed atomic.Int64
 	var wg sync.WaitGroup
 	for range workerCount {
 		wg.Go(func() {
-			for filePath := range jobs {
-				results <- resizeImage(filePath, false)
+			for i := range jobs {
+				// A job may have been handed out just before cancellation
+				if ctx.Err() != nil {
+					continue
+				}
+				res := processFile(ctx, resizer, files[i], false)
+				if res.err != nil && failFast &&
+					!allowErrors.allows(int(failed.Add(1)), len(pending)) {
+					cancel()
+				}
+				results <- indexedResult{index: i, fileResult: res}
 			}
 		})
 	}
 
-	// Send image file paths to the jobs channel
+	// Send image file indexes to the jobs channel until done or canceled
 	go func() {
 		defer close(jobs)
-		for _, filePath := range files {
-			jobs <- filePath
+		for _, i := range pending {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
@@ -74,42 +230,189 @@ func runWorkerPool(files []string) {
 	}()
 
 	// Collect and count results from workers
-	successCount := 0
-	errorCount := 0
-	for err := range results {
-		if err != nil {
+	for res := range results {
+		if errors.Is(res.err, context.Canceled) {
+			// Abandoned in flight: nothing was written, count it as canceled
+			continue
+		}
+		records[res.index] = res.fileResult
+		switch {
+		case res.err != nil:
 			if verbose {
-				fmt.Printf("Error: %v\n", err)
+				fmt.Printf("Error: %v\n", res.err)
 			}
-			errorCount++
-		} else {
-			successCount++
+			summary.errors++
+		case res.skipped != "":
+			summary.skipped++
+		default:
+			summary.success++
 		}
 	}
+	summary.canceled = summary.total - summary.success - summary.errors - summary.skipped
+	summary.interrupted = parent.Err() != nil
+
+	if summary.skipped > 0 {
+		fmt.Printf("Batch processing completed: %d success, %d errors, %d skipped\n",
+			summary.success, summary.errors, summary.skipped)
+	} else {
+		fmt.Printf("Batch processing completed: %d success, %d errors\n", summary.success, summary.errors)
+	}
+	switch {
+	case summary.interrupted:
+		fmt.Printf("Interrupted: %d files not processed\n", summary.canceled)
+	case summary.canceled > 0:
+		fmt.Printf("Stopped early (--fail-fast): %d files not processed\n", summary.canceled)
+	}
 
-	fmt.Printf("Batch processing completed: %d success, %d errors\n", successCount, errorCount)
+	// Files that were never processed have no record to report
+	records = slices.DeleteFunc(records, func(r fileResult) bool { return r.path == "" })
+	if err := writeReport(records); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := skip.finish(records); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	return summary
+}
+
+// collision is an output path that more than one input would write.
+type collision struct {
+	output string
+	inputs []string
 }
 
 /*
-collectImageFiles recursively collects all supported image files from the given directory.
-Returns a slice of file paths and any error encountered.
+findCollisions plans the outputs of files from their headers and returns every
+output or backup path that more than one of them would write, in input order.
+Files whose header cannot be read are left for the workers to report.
 */
-func collectImageFiles(dirPath string) ([]string, error) {
-	var imageFiles []string
-
-	// Walk through the directory and collect files with supported extensions.
-	// WalkDir avoids an lstat per entry (it only needs the dir-entry type here).
-	err := filepath.WalkDir(dirPath, func(path string, d os.DirEntry, err error) error {
+func findCollisions(resizer *resize.Resizer, files []string) []collision {
+	var planned []*resize.Result
+	for _, path := range files {
+		results, err := resizer.Plan(path)
 		if err != nil {
-			return err
+			continue
 		}
+		planned = append(planned, results...)
+	}
+	return collide(planned)
+}
+
+/*
+refuseCollisions exits before anything is written if two of files, or two
+sizes of one file, would write the same output (see findCollisions).
+*/
+func refuseCollisions(resizer *resize.Resizer, files []string) {
+	collisions := findCollisions(resizer, files)
+	if len(collisions) == 0 {
+		return
+	}
+	for _, c := range collisions {
+		slog.Error(fmt.Sprintf("Output collision: %s would be written by %s",
+			c.output, strings.Join(c.inputs, ", ")))
+	}
+	slog.Error(fmt.Sprintf("Found %d output collisions, nothing was processed", len(collisions)))
+	os.Exit(1)
+}
 
-		if !d.IsDir() && isImageFile(path) {
-			imageFiles = append(imageFiles, path)
+/*
+collide returns the output and backup paths that more than one of the planned
+results would write, including two sizes of one input that come out with
+different dimensions but the same name. The same size requested twice, and
+the backup the sizes of one input share, are not collisions.
+*/
+func collide(planned []*resize.Result) []collision {
+	writers := map[string][]string{}
+	first := map[string]*resize.Result{}
+	var outputs []string
+	add := func(path, input string) {
+		if _, ok := writers[path]; !ok {
+			outputs = append(outputs, path)
+		}
+		writers[path] = append(writers[path], input)
+	}
+	for _, result := range planned {
+		prev := first[result.OutputPath]
+		switch {
+		case prev == nil:
+			first[result.OutputPath] = result
+			add(result.OutputPath, result.InputPath)
+		case prev.InputPath != result.InputPath ||
+			prev.Width != result.Width || prev.Height != result.Height:
+			add(result.OutputPath, result.InputPath)
+		}
+		if result.BackupPath != "" && !slices.Contains(writers[result.BackupPath], result.InputPath) {
+			add(result.BackupPath, result.InputPath)
 		}
+	}
 
-		return nil
-	})
+	var collisions []collision
+	for _, output := range outputs {
+		if inputs := writers[output]; len(inputs) > 1 {
+			collisions = append(collisions, collision{output: output, inputs: inputs})
+		}
+	}
+	return collisions
+}
+
+// indexedResult pairs a worker's fileResult with the index of its input file.
+type indexedResult struct {
+	index int
+	fileResult
+}
+
+/*
+collectImageFiles collects the supported image files below the given directory,
+recursively unless limited by --max-depth or --no-recursive, and filtered by
+the other walk options (see walker). Returns the file paths and any error
+encountered.
+*/
+func collectImageFiles(dirPath string) ([]string, error) {
+	w := &walker{root: dirPath}
+	dir := dirPath
+	if followSymlinks {
+		// The directory itself may be a symlink; paths keep the name it was given by
+		real, err := filepath.EvalSymlinks(dirPath)
+		if err != nil {
+			return nil, err
+		}
+		dir = real
+		w.visited = append(w.visited, real)
+	}
 
-	return imageFiles, err
+	err := w.walk(dir, dirPath, 0)
+	return w.files, err
+}
+
+/*
+excludeGenerated drops files that look like outputs of an earlier run with the
+current naming options (see resize.Options.IsOutput), so that running the tool
+over the same folder again does not resize its own outputs. root is the
+directory mirrored under --output. Nothing is dropped with --include-generated.
+*/
+func excludeGenerated(root string, files []string) []string {
+	if includeGenerated {
+		return files
+	}
+	opts := resizeOptions()
+	opts.InputRoot = root
+	matcher := opts.NewOutputMatcher()
+
+	kept := make([]string, 0, len(files))
+	for _, path := range files {
+		if matcher.IsOutput(path) {
+			if verbose {
+				fmt.Printf("Excluding previously generated file: %s\n", path)
+			}
+			continue
+		}
+		kept = append(kept, path)
+	}
+	if excluded := len(files) - len(kept); excluded > 0 {
+		fmt.Printf("Excluded %d previously generated files (use --include-generated to process them)\n", excluded)
+	}
+	return kept
 }
@@ -1,27 +1,89 @@
 package main
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 
+	"github.com/appleboy/resize-tool/resize"
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/spf13/cobra"
 )
 
+// defaultMemoryBudget is the default --memory-budget in MiB.
+const defaultMemoryBudget = 1024
+
 // Global variables for command-line flags and internal state
 var (
 	width     int    // Output image width in pixels
 	height    int    // Output image height in pixels
-	quality   int    // JPEG quality (1-100)
+	sizeList  string // Comma-separated list of output sizes (e.g. 320,640,1280x720)
+	scaleFlag string // Proportional scale as a percentage (e.g. 50%)
+	maxSize   int    // Longest edge of the output in pixels
+	minSize   int    // Shortest edge of the output in pixels
+	quality   int    // JPEG and lossy WebP quality (1-100)
+	lossless  bool   // Whether to encode WebP losslessly
 	outputDir string // Output directory for resized images
 	keepRatio bool   // Whether to keep aspect ratio when both width and height are set
+	mode      string // Resize mode when both width and height are set (fit, fill, pad, stretch)
+	anchor    string // Crop anchor for fill mode, placement for pad mode
+	bgColor   string // Background color for pad mode and alpha flattening
+	filter    string // Resampling filter name
+	noOrient  bool   // Whether to ignore the EXIF orientation tag on decode
+	metaMode  string // Which source metadata to copy to the output
+	format    string // Output format override (default: same as input)
 	batchMode bool   // Whether to process all images in a directory
 	workers   int    // Number of worker goroutines for batch processing
 	verbose   bool   // Enable verbose output
 	overwrite bool   // Whether to overwrite original files
+	backup    string // Backup directory or suffix for files replaced by --overwrite
+	nameTmpl  string // Template for output file names
+
+	reportPath   string // Path of the machine-readable report (empty = no report)
+	reportFormat string // Report format: json or csv (default: from reportPath extension)
+
+	allowErrorsValue string      // Failed files tolerated before exiting non-zero (count or percentage)
+	failFast         bool        // Whether to stop the batch once the allowed errors are exceeded
+	allowErrors      errorPolicy // Parsed from allowErrorsValue
+
+	skipExisting bool   // Whether to skip inputs whose outputs already exist
+	incremental  bool   // Whether to skip inputs that are unchanged since the last run
+	stateFile    string // State file used by --incremental
+
+	dryRun bool // Whether to only print what would be done
+
+	toStdout bool // Whether to write the single resized image to stdout
+
+	fixExtension bool // Whether to name outputs after the format detected from their input's content
+
+	includeGenerated bool // Whether discovery keeps files that look like outputs of earlier runs
+
+	includes       []string // Glob patterns files in directory walks must match
+	excludes       []string // Glob patterns of files and directories left out of directory walks
+	maxDepth       int      // Directory levels to descend below the batch directory (-1 = unlimited)
+	noRecursive    bool     // Whether to only process the files directly in the batch directory
+	skipHidden     bool     // Whether to leave out hidden files and directories
+	followSymlinks bool     // Whether to follow symbolic links to directories
+
+	noUpscale        bool        // Whether to leave images alone that would be enlarged
+	onlyEnlarge      bool        // Whether to leave images alone that would not be enlarged
+	shrinkLimit      string      // Only process images larger than this size (W, WxH or xH)
+	shrinkLargerThan resize.Size // Parsed from shrinkLimit
+
+	maxPixels     int64 // Reject images declaring more pixels than this (0 = no limit)
+	maxInputBytes int64 // Reject input files larger than this (0 = no limit)
+	memoryBudget  int   // MiB of decoded image data allowed in memory at once (0 = no limit)
 
 	// Flags to track if dimensions were explicitly set by the user
 	widthSet  bool
 	heightSet bool
+
+	// Output sizes parsed from sizeList
+	sizes []resize.Size
+
+	// Scale factor parsed from scaleFlag (0 = not set)
+	scale float64
 )
 
 // setupConfig initializes the CLI configuration, flags, and validation
@@ -34,11 +96,37 @@ func setupConfig() {
 		IntVarP(&width, "width", "w", 0, "Output width (pixels, 0=auto based on height)")
 	rootCmd.Flags().
 		IntVarP(&height, "height", "", 0, "Output height (pixels, 0=auto based on width)")
-	rootCmd.Flags().IntVarP(&quality, "quality", "q", 95, "JPEG quality (1-100)")
+	rootCmd.Flags().
+		StringVar(&sizeList, "sizes", "", "Generate several sizes from one decode, e.g. 320,640,1280x720 (WxH, W or xH)")
+	rootCmd.Flags().
+		StringVar(&scaleFlag, "scale", "", "Scale proportionally by a percentage, e.g. 50%")
+	rootCmd.Flags().
+		IntVar(&maxSize, "max-size", 0, "Resize so the longest edge is this many pixels (any orientation)")
+	rootCmd.Flags().
+		IntVar(&minSize, "min-size", 0, "Resize so the shortest edge is this many pixels (any orientation)")
+	rootCmd.Flags().IntVarP(&quality, "quality", "q", 95, "JPEG and lossy WebP quality (1-100)")
+	rootCmd.Flags().
+		BoolVar(&lossless, "lossless", false, "Encode WebP output losslessly (ignores --quality)")
 	rootCmd.Flags().
 		StringVarP(&outputDir, "output", "o", "", "Output directory (default: same as input)")
 	rootCmd.Flags().
 		BoolVarP(&keepRatio, "keep-ratio", "k", false, "Keep aspect ratio when both width and height are specified")
+	rootCmd.Flags().
+		StringVar(&mode, "mode", "", "Resize mode when both width and height are set: fit, fill, pad, stretch (default: stretch, or fit with --keep-ratio)")
+	rootCmd.Flags().
+		StringVar(&anchor, "anchor", "center", "Crop anchor for fill mode or image placement for pad mode: center, top, bottom, left, right, top-left, top-right, bottom-left, bottom-right")
+	rootCmd.Flags().
+		StringVar(&bgColor, "background", "white", "Background color for pad mode (#rrggbb, #rrggbbaa, white, black or transparent)")
+	rootCmd.Flags().
+		StringVar(&filter, "filter", "lanczos", "Resampling filter: "+resize.FilterNames)
+	rootCmd.Flags().
+		BoolVar(&noOrient, "no-auto-orient", false, "Do not rotate JPEGs according to their EXIF orientation tag")
+	rootCmd.Flags().
+		StringVar(&metaMode, "metadata", "strip", "Source metadata to copy to the output: keep, strip, copyright-only")
+	rootCmd.Flags().
+		StringVar(&format, "format", "", "Output format: jpg, png, gif, tiff, bmp, webp (default: same as input)")
+	rootCmd.Flags().
+		StringVar(&nameTmpl, "name-template", resize.DefaultNameTemplate, "Output file name template using "+resize.NamePlaceholders)
 	rootCmd.Flags().
 		BoolVarP(&batchMode, "batch", "b", false, "Batch process all images in directory")
 	rootCmd.Flags().
@@ -46,6 +134,61 @@ func setupConfig() {
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
 	rootCmd.Flags().
 		BoolVar(&overwrite, "overwrite", false, "Overwrite original files instead of creating new ones")
+	rootCmd.Flags().
+		BoolVar(&fixExtension, "fix-extension", false, "Name outputs with the extension of the format detected from the content when the input's is missing or wrong")
+	rootCmd.Flags().
+		StringVar(&backup, "backup", "", "With --overwrite, keep originals in this directory (e.g. originals/) or next to them with this suffix (e.g. .bak)")
+
+	rootCmd.Flags().
+		StringVar(&reportPath, "report", "", "Write a per-file report of the results to this path")
+	rootCmd.Flags().
+		StringVar(&reportFormat, "report-format", "", "Report format: json or csv (default: csv for .csv paths, otherwise json)")
+
+	rootCmd.Flags().
+		StringVar(&allowErrorsValue, "allow-errors", "0", "Number (e.g. 3) or percentage (e.g. 5%) of failed files allowed before exiting with an error")
+	rootCmd.Flags().
+		BoolVar(&failFast, "fail-fast", false, "Stop processing remaining files once more files failed than --allow-errors permits")
+
+	rootCmd.Flags().
+		BoolVar(&skipExisting, "skip-existing", false, "Skip images whose output files already exist")
+	rootCmd.Flags().
+		BoolVar(&incremental, "incremental", false, "Skip images that are unchanged since the last --incremental run")
+	rootCmd.Flags().
+		StringVar(&stateFile, "state-file", defaultStateFile, "State file recording processed images for --incremental")
+
+	rootCmd.Flags().
+		BoolVar(&toStdout, "stdout", false, "Write the resized image to stdout instead of a file (use - as the input to read it from stdin)")
+	rootCmd.Flags().
+		BoolVar(&dryRun, "dry-run", false, "Print the planned outputs and sizes from the image headers without writing anything")
+	rootCmd.Flags().
+		BoolVar(&includeGenerated, "include-generated", false, "Also process files that look like outputs of an earlier run (e.g. photo_800x600.jpg next to photo.jpg)")
+
+	rootCmd.Flags().
+		BoolVar(&noUpscale, "no-upscale", false, "Leave images alone that would have to be enlarged")
+	rootCmd.Flags().
+		BoolVar(&onlyEnlarge, "only-enlarge", false, "Only process images that would be enlarged")
+	rootCmd.Flags().
+		StringVar(&shrinkLimit, "only-shrink-larger-than", "", "Only process images wider or taller than this size (W, WxH or xH)")
+
+	rootCmd.Flags().
+		StringArrayVar(&includes, "include", nil, "Only process files matching this glob in directory walks (repeatable), e.g. \"*.jpg\" or \"products/*/*.png\"")
+	rootCmd.Flags().
+		StringArrayVar(&excludes, "exclude", nil, "Leave out files and directories matching this glob in directory walks (repeatable), e.g. node_modules")
+	rootCmd.Flags().
+		IntVar(&maxDepth, "max-depth", -1, "Directory levels to descend below the batch directory (0 = only its own files, -1 = unlimited)")
+	rootCmd.Flags().
+		BoolVar(&noRecursive, "no-recursive", false, "Only process the files directly in the batch directory (same as --max-depth 0)")
+	rootCmd.Flags().
+		BoolVar(&skipHidden, "skip-hidden", false, "Leave out hidden files and directories (names starting with a dot)")
+	rootCmd.Flags().
+		BoolVar(&followSymlinks, "follow-symlinks", false, "Follow symbolic links to directories in directory walks (loops are skipped)")
+
+	rootCmd.Flags().
+		Int64Var(&maxPixels, "max-pixels", 0, "Reject images with more pixels than this, checked from the header before decoding (0 = no limit)")
+	rootCmd.Flags().
+		Int64Var(&maxInputBytes, "max-input-bytes", 0, "Reject input files larger than this many bytes (0 = no limit)")
+	rootCmd.Flags().
+		IntVar(&memoryBudget, "memory-budget", defaultMemoryBudget, "MiB of image data decoded at once; workers wait for room (0 = no limit)")
 
 	// PreRun: Validate and set up parameters before running the main command
 	rootCmd.PreRun = validateConfig
@@ -60,10 +203,54 @@ func validateConfig(cmd *cobra.Command, args []string) {
 	widthSet = cmd.Flags().Changed("width")
 	heightSet = cmd.Flags().Changed("height")
 
-	// If neither width nor height is set, default to width 800 (height
-	// auto-calculated from the aspect ratio). height/heightSet already hold
-	// their zero values here, so only the width side needs setting.
-	if !widthSet && !heightSet {
+	// --sizes replaces --width/--height with a list of output sizes
+	sizes = nil
+	if sizeList != "" {
+		if widthSet || heightSet {
+			slog.Error("Cannot use --sizes with --width or --height")
+			os.Exit(1)
+		}
+		parsed, err := resize.ParseSizes(sizeList)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		if overwrite && len(parsed) > 1 {
+			slog.Error("Cannot use --overwrite with more than one size in --sizes")
+			os.Exit(1)
+		}
+		sizes = parsed
+	}
+
+	// --scale, --max-size and --min-size are alternatives to all of the above
+	scale = 0
+	if scaleFlag != "" {
+		parsed, err := resize.ParseScale(scaleFlag)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		scale = parsed
+	}
+	if maxSize < 0 || minSize < 0 {
+		slog.Error("Max size and min size must be positive numbers")
+		os.Exit(1)
+	}
+	sizings := 0
+	for _, set := range []bool{widthSet || heightSet, sizes != nil, scale > 0, maxSize > 0, minSize > 0} {
+		if set {
+			sizings++
+		}
+	}
+	if sizings > 1 {
+		slog.Error("Use only one of --width/--height, --sizes, --scale, --max-size or --min-size")
+		os.Exit(1)
+	}
+
+	// If no size is set at all, default to width 800 (height auto-calculated
+	// from the aspect ratio). height/heightSet already hold their zero values
+	// here, so only the width side needs setting.
+	if sizings == 0 {
 		width = 800
 		widthSet = true
 	}
@@ -73,7 +260,7 @@ func validateConfig(cmd *cobra.Command, args []string) {
 		slog.Error("Width and height must be positive numbers")
 		os.Exit(1)
 	}
-	if width == 0 && height == 0 {
+	if (widthSet || heightSet) && width == 0 && height == 0 {
 		slog.Error("At least one of width or height must be specified")
 		os.Exit(1)
 	}
@@ -81,11 +268,69 @@ func validateConfig(cmd *cobra.Command, args []string) {
 		slog.Error("Quality must be between 1 and 100")
 		os.Exit(1)
 	}
+	if mode != "" {
+		m, err := resize.ParseMode(mode)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		if keepRatio && m != resize.ModeFit {
+			slog.Error("Cannot use --keep-ratio with --mode " + string(m))
+			os.Exit(1)
+		}
+		mode = string(m)
+	}
+	a, err := resize.ParseAnchor(anchor)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	anchor = string(a)
+	if _, err := resize.ParseColor(bgColor); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	f, err := resize.ParseFilter(filter)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	filter = string(f)
+	m, err := resize.ParseMetadataMode(metaMode)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	metaMode = string(m)
+	if format != "" {
+		f, err := resize.ParseFormat(format)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		format = string(f)
+	}
 	if workers < 1 {
 		slog.Error("Number of workers must be at least 1")
 		os.Exit(1)
 	}
 
+	if reportPath != "" {
+		f, err := resolveReportFormat(reportPath, reportFormat)
+		if err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		reportFormat = f
+	}
+
+	policy, err := parseErrorPolicy(allowErrorsValue)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	allowErrors = policy
+
 	// Validate overwrite and output flags combination
 	if overwrite && outputDir != "" {
 		slog.Error(
@@ -93,4 +338,66 @@ func validateConfig(cmd *cobra.Command, args []string) {
 		)
 		os.Exit(1)
 	}
+	if cmd.Flags().Changed("name-template") && overwrite {
+		slog.Error("Cannot use --name-template with --overwrite: --overwrite keeps the original file name")
+		os.Exit(1)
+	}
+	if err := resize.ValidateNameTemplate(nameTmpl, sizes); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if noUpscale && onlyEnlarge {
+		slog.Error("Cannot use --no-upscale with --only-enlarge")
+		os.Exit(1)
+	}
+	shrinkLargerThan = resize.Size{}
+	if shrinkLimit != "" {
+		parsed, err := resize.ParseSizes(shrinkLimit)
+		if err != nil || len(parsed) != 1 {
+			slog.Error(fmt.Sprintf("Invalid --only-shrink-larger-than size %q (use W, WxH or xH)", shrinkLimit))
+			os.Exit(1)
+		}
+		if onlyEnlarge {
+			slog.Error("Cannot use --only-enlarge with --only-shrink-larger-than")
+			os.Exit(1)
+		}
+		shrinkLargerThan = parsed[0]
+	}
+	if maxDepth < -1 {
+		slog.Error("Max depth must be -1 (unlimited) or a positive number")
+		os.Exit(1)
+	}
+	if noRecursive {
+		if cmd.Flags().Changed("max-depth") && maxDepth != 0 {
+			slog.Error("Cannot use --no-recursive with --max-depth")
+			os.Exit(1)
+		}
+		maxDepth = 0
+	}
+	for _, pattern := range append(slices.Clone(includes), excludes...) {
+		if !doublestar.ValidatePattern(pattern) {
+			slog.Error(fmt.Sprintf("Invalid glob pattern %q", pattern))
+			os.Exit(1)
+		}
+	}
+	if maxPixels < 0 || maxInputBytes < 0 || memoryBudget < 0 {
+		slog.Error("Max pixels, max input bytes and memory budget must be positive numbers")
+		os.Exit(1)
+	}
+	if backup != "" && !overwrite {
+		slog.Error("Cannot use --backup without --overwrite")
+		os.Exit(1)
+	}
+	if skipExisting && overwrite {
+		slog.Error("Cannot use --skip-existing with --overwrite: the output is always the existing original")
+		os.Exit(1)
+	}
+	if stateFile == "" {
+		slog.Error("--state-file must not be empty")
+		os.Exit(1)
+	}
+	if err := validateStream(args); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
 }
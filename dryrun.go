@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/appleboy/resize-tool/resize"
+)
+
+/*
+planRun implements --dry-run: it reads only the header of every file, prints
+where each output would be written and at which size, and flags outputs that
+collide or would be larger than the original. Nothing is decoded or written.
+It exits with status 1 if any outputs collide, as a real run would refuse them.
+*/
+func planRun(resizer *resize.Resizer, files []string) batchSummary {
+	skip, err := newSkipper(resizer)
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Println("Dry run: no files will be written")
+
+	summary := batchSummary{total: len(files)}
+	var planned []*resize.Result
+	var outputs [][]*resize.Result
+	for _, path := range files {
+		if reason := skip.reason(path); reason != "" {
+			fmt.Printf("%s: skipped (%s)\n", path, reason)
+			summary.skipped++
+			continue
+		}
+		results, err := resizer.Plan(path)
+		if errors.Is(err, resize.ErrWithinBounds) {
+			fmt.Printf("%s: skipped (%s)\n", path, err)
+			summary.skipped++
+			continue
+		}
+		if err != nil {
+			fmt.Printf("%s: error: %v\n", path, err)
+			summary.errors++
+			continue
+		}
+		summary.success++
+		planned = append(planned, results...)
+		outputs = append(outputs, results)
+	}
+
+	collisions := collide(planned)
+	colliding := map[string]bool{}
+	for _, c := range collisions {
+		colliding[c.output] = true
+	}
+
+	upscales := 0
+	for _, results := range outputs {
+		for _, result := range results {
+			var flags []string
+			if colliding[result.OutputPath] {
+				flags = append(flags, "collision")
+			}
+			if upscaled(result) {
+				flags = append(flags, "upscale")
+				upscales++
+			}
+			if _, err := os.Stat(result.OutputPath); err == nil {
+				flags = append(flags, "replaces existing file")
+			}
+			if warning := extensionWarning(result.InputPath, result.InputFormat); warning != "" {
+				flags = append(flags, warning)
+			}
+
+			line := fmt.Sprintf("%s (%dx%d) -> %s (%dx%d)",
+				result.InputPath, result.OriginalWidth, result.OriginalHeight,
+				result.OutputPath, result.Width, result.Height)
+			if len(flags) > 0 {
+				line += " [" + strings.Join(flags, ", ") + "]"
+			}
+			fmt.Println(line)
+		}
+	}
+
+	fmt.Printf(
+		"Dry run: %d files, %d outputs planned, %d skipped, %d errors, %d upscales, %d collisions\n",
+		summary.total, len(planned), summary.skipped, summary.errors, upscales, len(collisions),
+	)
+	if len(collisions) > 0 {
+		for _, c := range collisions {
+			slog.Error(fmt.Sprintf("Output collision: %s would be written by %s",
+				c.output, strings.Join(c.inputs, ", ")))
+		}
+		os.Exit(1)
+	}
+
+	return summary
+}
+
+// upscaled reports whether a planned output is larger than its source in either dimension.
+func upscaled(result *resize.Result) bool {
+	return result.Width > result.OriginalWidth || result.Height > result.OriginalHeight
+}
@@ -1,5 +1,12 @@
 package main
 
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/appleboy/resize-tool/resize"
+)
+
 // Supported image file extensions.
 const (
 	extJPG  = ".jpg"
@@ -9,6 +16,7 @@ const (
 	extTIFF = ".tiff"
 	extTIF  = ".tif"
 	extBMP  = ".bmp"
+	extWebP = ".webp"
 )
 
 // supportedImageExts is the set of image file extensions the tool accepts.
@@ -20,4 +28,19 @@ var supportedImageExts = map[string]bool{
 	extTIFF: true,
 	extTIF:  true,
 	extBMP:  true,
+	extWebP: true,
+}
+
+/*
+extensionWarning describes a mismatch between the extension of path and the
+format detected from its content, or returns "" if they agree.
+*/
+func extensionWarning(path string, detected resize.Format) string {
+	if !resize.ExtensionMismatch(path, detected) {
+		return ""
+	}
+	if ext := filepath.Ext(path); ext != "" {
+		return fmt.Sprintf("content is %s but the extension is %s", detected, ext)
+	}
+	return fmt.Sprintf("content is %s but the file has no extension", detected)
 }
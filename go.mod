@@ -1,15 +1,20 @@
-module resize-tool
+module github.com/appleboy/resize-tool
 
 go 1.25.10
 
 require (
 	github.com/appleboy/com v1.2.1
+	github.com/bmatcuk/doublestar/v4 v4.9.1
 	github.com/disintegration/imaging v1.6.2
+	github.com/gen2brain/webp v0.5.5
 	github.com/spf13/cobra v1.10.2
+	golang.org/x/image v0.41.0
+	golang.org/x/sync v0.19.0
 )
 
 require (
+	github.com/ebitengine/purego v0.8.3 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.10 // indirect
-	golang.org/x/image v0.41.0 // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
 )
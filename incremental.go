@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/appleboy/resize-tool/resize"
+)
+
+// Reasons recorded for files that are skipped instead of processed.
+const (
+	skipOutputExists = "output exists"
+	skipUnchanged    = "unchanged since last run"
+)
+
+// defaultStateFile is where --incremental keeps its state unless --state-file is set.
+const defaultStateFile = ".resize-tool-state.json"
+
+/*
+buildState is the --incremental state file. It records, for every input that
+was processed successfully, what the file looked like and which outputs it
+produced, so unchanged inputs can be skipped on the next run.
+*/
+type buildState struct {
+	path  string
+	Files map[string]stateEntry `json:"files"`
+}
+
+// stateEntry describes one input as of the run that last processed it.
+type stateEntry struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Hash     string    `json:"sha256"`
+	Settings string    `json:"settings"` // Fingerprint of the resize options used
+	Outputs  []string  `json:"outputs"`
+}
+
+// loadState reads the --incremental state file, or returns nil if --incremental is off.
+func loadState() (*buildState, error) {
+	if !incremental {
+		return nil, nil
+	}
+
+	s := &buildState{path: stateFile, Files: map[string]stateEntry{}}
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %v", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %v", stateFile, err)
+	}
+	if s.Files == nil {
+		s.Files = map[string]stateEntry{}
+	}
+	return s, nil
+}
+
+/*
+unchanged reports whether the input at path was processed with the current
+settings, still has all of its outputs and has not changed since. Size and
+modification time are compared first; a file that was only touched is
+recognized by its content hash.
+*/
+func (s *buildState) unchanged(path string, settings string) bool {
+	entry, ok := s.Files[stateKey(path)]
+	if !ok || entry.Settings != settings {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != entry.Size {
+		return false
+	}
+	for _, output := range entry.Outputs {
+		if _, err := os.Stat(output); err != nil {
+			return false
+		}
+	}
+	if info.ModTime().Equal(entry.ModTime) {
+		return true
+	}
+	hash, err := hashFile(path)
+	return err == nil && hash == entry.Hash
+}
+
+/*
+update records the outcome of a run: processed inputs (including those a size
+guard left alone) get a fresh entry, failed ones are forgotten so they are
+retried, and ones skipped as up to date keep theirs.
+*/
+func (s *buildState) update(records []fileResult, settings string) {
+	for _, rec := range records {
+		key := stateKey(rec.path)
+		switch {
+		case rec.skipped == skipUnchanged || rec.skipped == skipOutputExists:
+			continue
+		case rec.err != nil:
+			delete(s.Files, key)
+			continue
+		}
+
+		info, err := os.Stat(rec.path)
+		if err != nil {
+			delete(s.Files, key)
+			continue
+		}
+		hash, err := hashFile(rec.path)
+		if err != nil {
+			delete(s.Files, key)
+			continue
+		}
+		entry := stateEntry{
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+			Hash:     hash,
+			Settings: settings,
+		}
+		for _, result := range rec.results {
+			entry.Outputs = append(entry.Outputs, result.OutputPath)
+		}
+		s.Files[key] = entry
+	}
+}
+
+// save writes the state file.
+func (s *buildState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state file: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state file directory: %v", err)
+	}
+	// #nosec G306 -- the state file holds no secrets
+	if err := os.WriteFile(s.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	return nil
+}
+
+// stateKey identifies an input in the state file independently of the working directory.
+func stateKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// hashFile returns the hex-encoded SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path) // #nosec G304 -- hashing user-specified input
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+/*
+settingsFingerprint identifies the resize options in effect, so that changing
+any of them makes --incremental reprocess every file.
+*/
+func settingsFingerprint(opts resize.Options) string {
+	sum := sha256.Sum256(fmt.Appendf(nil, "%+v", opts))
+	return hex.EncodeToString(sum[:8])
+}
+
+/*
+skipper decides which files --skip-existing and --incremental leave out of a
+run. A nil *skipper skips nothing.
+*/
+type skipper struct {
+	resizer  *resize.Resizer
+	state    *buildState
+	settings string
+}
+
+/*
+newSkipper returns the skipper for the current flags and the resizer that will
+process the files, or nil if neither mode is on.
+*/
+func newSkipper(resizer *resize.Resizer) (*skipper, error) {
+	if !skipExisting && !incremental {
+		return nil, nil
+	}
+
+	state, err := loadState()
+	if err != nil {
+		return nil, err
+	}
+	return &skipper{
+		resizer:  resizer,
+		state:    state,
+		settings: settingsFingerprint(resizer.Options()),
+	}, nil
+}
+
+/*
+reason returns why path does not need processing, or "" if it does. Files
+whose header cannot be read are never skipped so that the error is reported.
+*/
+func (s *skipper) reason(path string) string {
+	if s == nil {
+		return ""
+	}
+	if s.state != nil && s.state.unchanged(path, s.settings) {
+		return skipUnchanged
+	}
+	if skipExisting {
+		planned, err := s.resizer.Plan(path)
+		if err != nil {
+			return ""
+		}
+		for _, result := range planned {
+			if _, err := os.Stat(result.OutputPath); err != nil {
+				return ""
+			}
+		}
+		return skipOutputExists
+	}
+	return ""
+}
+
+// finish records the run in the state file when --incremental is on.
+func (s *skipper) finish(records []fileResult) error {
+	if s == nil || s.state == nil {
+		return nil
+	}
+	s.state.update(records, s.settings)
+	return s.state.save()
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 )
@@ -12,7 +16,7 @@ var rootCmd = &cobra.Command{
 	Short:   "A powerful image resizing tool",
 	Version: getVersion(),
 	Long: `A command-line tool to resize images with various options.
-Supports JPEG, PNG, GIF, TIFF, and BMP formats.
+Supports JPEG, PNG, GIF, TIFF, BMP, and WebP formats.
 Can process single files, batch process directories, or use glob patterns.
 
 By default, if only width or height is specified, the other dimension
@@ -23,6 +27,8 @@ Example usage:
 		resize-tool input.jpg --height 600
 		resize-tool images/ --batch --width 1024 --output resized/
 		resize-tool input.jpg --width 800 --overwrite
+		resize-tool input.jpg --width 400 --height 400 --mode fill --anchor top
+		resize-tool photos/ --batch --max-size 2048
 		resize-tool "images/*.png" --width 1024
 		resize-tool images/*.png --width 1024
 		resize-tool "photos/**/*.jpg" --quality 90 --height 800
@@ -33,8 +39,17 @@ Example usage:
 
 // Entry point of the application
 func main() {
+	// The first Ctrl-C cancels the context so that no new files are started and
+	// in-flight ones can finish. Restoring the default handler at that point
+	// lets a second Ctrl-C terminate the process immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, func() {
+		stop()
+		fmt.Fprintln(os.Stderr, "Interrupted, stopping after the files in progress (press Ctrl-C again to force exit)")
+	})
+
 	// Execute the root command
-	if err := rootCmd.Execute(); err != nil {
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		slog.Error("Failed to execute command", "err", err)
 		os.Exit(1)
 	}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"image"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/appleboy/com/file"
-	"github.com/disintegration/imaging"
+	"github.com/appleboy/resize-tool/resize"
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/spf13/cobra"
 )
 
@@ -19,29 +23,45 @@ and processes it accordingly. If batch mode is enabled or the input is a directo
 it processes all images in the directory. Otherwise, it processes a single image file.
 Supports glob patterns like images/*.png or photos/**\/*.jpg.
 Also handles multiple arguments when shell expands glob patterns.
+Exits with a non-zero status if more files failed than --allow-errors permits.
+The command context is canceled on Ctrl-C, which stops processing early.
 */
 func processImages(cmd *cobra.Command, args []string) {
-	// Handle multiple arguments (shell-expanded glob or multiple files)
-	if len(args) > 1 {
-		// Filter out non-image files
-		var imageFiles []string
-		for _, path := range args {
-			info, err := os.Stat(path)
-			if err != nil {
-				slog.Error(fmt.Sprintf("Cannot access file: %s, error: %v", path, err))
-				continue
-			}
-			if !info.IsDir() && isImageFile(path) {
-				imageFiles = append(imageFiles, path)
+	ctx := cmd.Context()
+	if ctx == nil {
+		// Commands that were not started through Execute have no context
+		ctx = context.Background()
+	}
+
+	// "-" and --stdout stream a single image without touching any output file
+	if toStdout {
+		if err := resizeStream(ctx, args[0]); err != nil {
+			if errors.Is(err, context.Canceled) {
+				slog.Error("Interrupted")
+				os.Exit(130)
 			}
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Handle multiple arguments (shell-expanded glob, multiple files or patterns)
+	if len(args) > 1 {
+		imageFiles, err := expandArgs(args)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Failed to expand glob pattern: %v", err))
+			os.Exit(1)
 		}
 
+		// Shell-expanded globs list earlier outputs too
+		imageFiles = excludeGenerated(commonDir(imageFiles), imageFiles)
 		if len(imageFiles) == 0 {
 			slog.Error("No valid image files found in arguments")
 			os.Exit(1)
 		}
 
-		resizeFiles(imageFiles)
+		checkErrors(resizeFiles(ctx, imageFiles))
 		return
 	}
 
@@ -56,13 +76,14 @@ func processImages(cmd *cobra.Command, args []string) {
 			slog.Error(fmt.Sprintf("Failed to expand glob pattern: %v", err))
 			os.Exit(1)
 		}
+		files = excludeGenerated(commonDir(files), files)
 
 		if len(files) == 0 {
 			slog.Error(fmt.Sprintf("No image files match pattern: %s", inputPath))
 			os.Exit(1)
 		}
 
-		resizeFiles(files)
+		checkErrors(resizeFiles(ctx, files))
 		return
 	}
 
@@ -75,13 +96,10 @@ func processImages(cmd *cobra.Command, args []string) {
 
 	if info.IsDir() || batchMode {
 		// Process all images in the directory
-		processBatch(inputPath)
+		checkErrors(processBatch(ctx, inputPath))
 	} else {
 		// Process a single image file
-		if err := resizeImage(inputPath, true); err != nil {
-			slog.Error(fmt.Sprintf("Failed to process image: %v", err))
-			os.Exit(1)
-		}
+		checkErrors(resizeSingle(ctx, inputPath))
 	}
 }
 
@@ -106,236 +124,389 @@ func statInputPath(inputPath string) (os.FileInfo, error) {
 resizeFiles dispatches a list of image files: a single file is resized directly
 (with rich per-file output), while multiple files go through the worker pool.
 */
-func resizeFiles(files []string) {
+func resizeFiles(ctx context.Context, files []string) batchSummary {
 	if len(files) == 1 {
-		if err := resizeImage(files[0], true); err != nil {
-			slog.Error(fmt.Sprintf("Failed to process image: %v", err))
-			os.Exit(1)
-		}
-		return
+		return resizeSingle(ctx, files[0])
 	}
-	processMultipleFiles(files)
+	return processMultipleFiles(ctx, files)
 }
 
 /*
-resizeImage resizes a single image file according to the specified parameters.
-It preserves aspect ratio if required and saves the output. When detailed is
-true (single-file runs) it prints the per-file result block; worker-pool calls
-pass detailed=false so that, without --verbose, the pool prints only its summary
-instead of per-file blocks. With --verbose every call still prints its progress
-and result lines, so concurrent pool output may interleave.
+resizeSingle resizes one image with rich per-file output and writes the report
+if requested. A failure is logged and counted in the returned summary.
 */
-func resizeImage(inputPath string, detailed bool) error {
-	if verbose {
-		fmt.Printf("Processing: %s\n", inputPath)
-		if overwrite {
-			fmt.Printf("  Warning: Will overwrite original file\n")
-		}
+func resizeSingle(ctx context.Context, inputPath string) batchSummary {
+	resizer, err := newResizer("")
+	if err != nil {
+		slog.Error(fmt.Sprintf("Failed to process image: %v", err))
+		return batchSummary{total: 1, errors: 1}
 	}
-
-	// Open and decode the input image file
-	src, err := imaging.Open(inputPath)
+	if dryRun {
+		return planRun(resizer, []string{inputPath})
+	}
+	skip, err := newSkipper(resizer)
 	if err != nil {
-		return fmt.Errorf("failed to open image %s: %v", inputPath, err)
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
 
-	// Get original image dimensions (Dx/Dy account for a non-zero bounds origin)
-	originalBounds := src.Bounds()
-	originalWidth := originalBounds.Dx()
-	originalHeight := originalBounds.Dy()
-
-	if verbose {
-		fmt.Printf("  Original size: %dx%d\n", originalWidth, originalHeight)
+	summary := batchSummary{total: 1}
+	var record fileResult
+	if reason := skip.reason(inputPath); reason != "" {
+		fmt.Printf("Skipped %s: %s\n", filepath.Base(inputPath), reason)
+		record = fileResult{path: inputPath, skipped: reason}
+	} else {
+		refuseCollisions(resizer, []string{inputPath})
+		record = processFile(ctx, resizer, inputPath, true)
+		if errors.Is(record.err, context.Canceled) {
+			return batchSummary{total: 1, canceled: 1, interrupted: true}
+		}
 	}
 
-	// Calculate target dimensions based on flags and original size
-	targetWidth, targetHeight := calculateTargetSize(originalWidth, originalHeight)
-
-	if verbose {
-		fmt.Printf("  Target size: %dx%d\n", targetWidth, targetHeight)
+	if err := writeReport([]fileResult{record}); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	if err := skip.finish([]fileResult{record}); err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
 
-	var resized image.Image
-
-	// Choose resizing method based on which dimensions were set and the keep-ratio flag
 	switch {
-	case widthSet && !heightSet:
-		// Only width set, height is auto-calculated
-		resized = imaging.Resize(src, targetWidth, 0, imaging.Lanczos)
-	case !widthSet && heightSet:
-		// Only height set, width is auto-calculated
-		resized = imaging.Resize(src, 0, targetHeight, imaging.Lanczos)
-	case keepRatio && targetWidth > 0 && targetHeight > 0:
-		// Both set to positive values, keep ratio (fit within bounds)
-		resized = imaging.Fit(src, targetWidth, targetHeight, imaging.Lanczos)
+	case record.err != nil:
+		slog.Error(fmt.Sprintf("Failed to process image: %v", record.err))
+		summary.errors = 1
+	case record.skipped != "":
+		summary.skipped = 1
 	default:
-		// Force resize to the given dimensions (a 0 dimension is auto-derived
-		// by imaging; with both set and no keep-ratio this may distort).
-		resized = imaging.Resize(src, targetWidth, targetHeight, imaging.Lanczos)
-	}
-
-	// Get actual resized dimensions (used for output filename)
-	actualBounds := resized.Bounds()
-	actualWidth := actualBounds.Dx()
-	actualHeight := actualBounds.Dy()
-
-	// Generate output file path
-	outputPath := generateOutputPath(inputPath, outputDir, actualWidth, actualHeight)
-
-	// Ensure output directory exists
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
-		return fmt.Errorf("failed to create output directory: %v", err)
+		summary.success = 1
 	}
+	return summary
+}
 
-	// Save the resized image in the appropriate format
-	var saveErr error
-	ext := strings.ToLower(filepath.Ext(inputPath))
-
-	switch ext {
-	case extJPG, extJPEG:
-		saveErr = imaging.Save(resized, outputPath, imaging.JPEGQuality(quality))
-	case extPNG, extGIF, extTIFF, extTIF, extBMP:
-		saveErr = imaging.Save(resized, outputPath)
-	default:
-		return fmt.Errorf("unsupported image format: %s", ext)
-	}
+// fileResult is the outcome of processing one input file.
+type fileResult struct {
+	path     string
+	results  []*resize.Result // One per written output (several with --sizes)
+	duration time.Duration
+	err      error
+	skipped  string // Why the file was not processed (empty if it was)
+}
 
-	if saveErr != nil {
-		return fmt.Errorf("failed to save image: %v", saveErr)
+/*
+processFile resizes one input file and records its outputs and timing. Files
+left alone by --no-upscale and the other size guards are recorded as skipped.
+*/
+func processFile(
+	ctx context.Context,
+	resizer *resize.Resizer,
+	inputPath string,
+	detailed bool,
+) fileResult {
+	start := time.Now()
+	results, err := resizeVariants(ctx, resizer, inputPath, detailed)
+	record := fileResult{
+		path:     inputPath,
+		results:  results,
+		duration: time.Since(start),
+		err:      err,
 	}
-
-	// Print the per-file result block for single-file runs or in verbose mode.
-	// Worker-pool calls pass detailed=false to avoid interleaved concurrent output.
-	if verbose || detailed {
-		fmt.Printf("Resized %s: %dx%d -> %dx%d\n",
-			filepath.Base(inputPath), originalWidth, originalHeight, actualWidth, actualHeight)
-		fmt.Printf("Output: %s\n", outputPath)
-
-		// Print file size information
-		originalInfo, err := os.Stat(inputPath)
-		if err != nil {
-			slog.Error(fmt.Sprintf("Failed to get original file info: %v", err))
-		} else {
-			newInfo, err := os.Stat(outputPath)
-			if err != nil {
-				slog.Error(fmt.Sprintf("Failed to get output file info: %v", err))
-			} else {
-				fmt.Printf("File size: %s -> %s\n",
-					file.FormatSize(originalInfo.Size()), file.FormatSize(newInfo.Size()))
-			}
+	if errors.Is(err, resize.ErrWithinBounds) {
+		record.err = nil
+		record.skipped = err.Error()
+		if verbose || detailed {
+			fmt.Printf("Skipped %s: %s\n", filepath.Base(inputPath), record.skipped)
 		}
 	}
+	return record
+}
 
-	return nil
+/*
+newResizer builds the resizer for the command-line flags. With --output, the
+directory tree below root (if set) is mirrored in the output directory.
+*/
+func newResizer(root string) (*resize.Resizer, error) {
+	opts := resizeOptions()
+	opts.InputRoot = root
+	return resize.New(opts)
 }
 
 /*
-calculateTargetSize computes the target width and height for resizing,
-preserving aspect ratio if only one dimension is set.
+resizeVariants resizes a single image file with resizer.
+When detailed is true (single-file runs) it prints the per-file result block;
+worker-pool calls pass detailed=false so that, without --verbose, the pool
+prints only its summary instead of per-file blocks. With --verbose every call
+still prints its progress and result lines, so concurrent pool output may
+interleave.
 */
-func calculateTargetSize(originalWidth, originalHeight int) (int, int) {
-	// If both dimensions are explicitly set, use them directly
-	if widthSet && heightSet {
-		return width, height
+func resizeVariants(
+	ctx context.Context,
+	resizer *resize.Resizer,
+	inputPath string,
+	detailed bool,
+) ([]*resize.Result, error) {
+	if verbose {
+		fmt.Printf("Processing: %s\n", inputPath)
+		if overwrite {
+			fmt.Printf("  Warning: Will overwrite original file\n")
+		}
+	}
+
+	// Decodes once and writes one output per --sizes entry (or just one)
+	results, err := resizer.ResizeFileVariants(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	// Always listed in the report; --fix-extension already takes care of the output name.
+	// Printed to stderr directly, as the logger only shows errors without --verbose.
+	if warning := extensionWarning(inputPath, results[0].InputFormat); warning != "" && !fixExtension {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s (use --fix-extension to name the output after its content)\n",
+			inputPath, warning)
 	}
 
-	// If only width is set, calculate height proportionally
-	if widthSet && !heightSet {
-		ratio := float64(originalHeight) / float64(originalWidth)
-		calculatedHeight := int(float64(width) * ratio)
-		return width, calculatedHeight
+	if verbose {
+		fmt.Printf("  Original size: %dx%d\n", results[0].OriginalWidth, results[0].OriginalHeight)
+		fmt.Printf("  Filter: %s\n", resizer.Options().Filter)
 	}
 
-	// If only height is set, calculate width proportionally
-	if !widthSet && heightSet {
-		ratio := float64(originalWidth) / float64(originalHeight)
-		calculatedWidth := int(float64(height) * ratio)
-		return calculatedWidth, height
+	for _, result := range results {
+		if verbose {
+			fmt.Printf("  Target size: %dx%d\n", result.TargetWidth, result.TargetHeight)
+		}
+
+		// Print the per-file result block for single-file runs or in verbose mode.
+		// Worker-pool calls pass detailed=false to avoid interleaved concurrent output.
+		if verbose || detailed {
+			printResult(result)
+		}
 	}
 
-	// This case should not happen as it's handled in PreRun
-	return width, height
+	return results, nil
+}
+
+// printResult prints the human-readable summary of a single resize.
+func printResult(result *resize.Result) {
+	fmt.Printf("Resized %s: %dx%d -> %dx%d\n",
+		filepath.Base(result.InputPath),
+		result.OriginalWidth, result.OriginalHeight, result.Width, result.Height)
+	fmt.Printf("Output: %s\n", result.OutputPath)
+	if result.BackupPath != "" {
+		fmt.Printf("Backup: %s\n", result.BackupPath)
+	}
+	fmt.Printf("File size: %s -> %s\n",
+		file.FormatSize(result.InputSize), file.FormatSize(result.OutputSize))
 }
 
 /*
-generateOutputPath creates the output file path for the resized image,
-including the new dimensions in the filename and using the specified output directory if provided.
-If overwrite is enabled, returns the original file path (ignoring outputDir).
+resizeOptions translates the command-line flags into resize.Options. A
+dimension that was not explicitly set is passed as zero so the engine derives
+it from the other one.
 */
-func generateOutputPath(inputPath, outputDir string, width, height int) string {
-	// If overwrite mode is enabled, always return original file path
-	if overwrite {
-		return inputPath
+func resizeOptions() resize.Options {
+	// bgColor was validated in validateConfig
+	background, _ := resize.ParseColor(bgColor)
+
+	opts := resize.Options{
+		KeepRatio:            keepRatio,
+		Mode:                 resize.Mode(mode),
+		Anchor:               resize.Anchor(anchor),
+		Background:           background,
+		Filter:               resize.Filter(filter),
+		Format:               resize.Format(format),
+		Quality:              quality,
+		Lossless:             lossless,
+		OutputDir:            outputDir,
+		Overwrite:            overwrite,
+		FixExtension:         fixExtension,
+		Backup:               backup,
+		NoAutoOrient:         noOrient,
+		Metadata:             resize.MetadataMode(metaMode),
+		Sizes:                sizes,
+		Scale:                scale,
+		MaxSize:              maxSize,
+		MinSize:              minSize,
+		NoUpscale:            noUpscale,
+		OnlyEnlarge:          onlyEnlarge,
+		OnlyShrinkLargerThan: shrinkLargerThan,
+		MaxPixels:            maxPixels,
+		MaxInputBytes:        maxInputBytes,
+		MemoryBudget:         int64(memoryBudget) << 20,
 	}
-
-	// Original logic: generate new filename with dimensions
-	dir := filepath.Dir(inputPath)
-	if outputDir != "" {
-		dir = outputDir
+	if widthSet {
+		opts.Width = width
 	}
-
-	filename := filepath.Base(inputPath)
-	ext := filepath.Ext(filename)
-	nameWithoutExt := strings.TrimSuffix(filename, ext)
-
-	newFilename := fmt.Sprintf("%s_%dx%d%s", nameWithoutExt, width, height, ext)
-	return filepath.Join(dir, newFilename)
+	if heightSet {
+		opts.Height = height
+	}
+	if !overwrite {
+		opts.NameTemplate = nameTmpl
+	}
+	return opts
 }
 
 /*
 containsGlobPattern checks if the input path contains glob pattern characters.
-Returns true if the path contains *, ?, or [ characters.
+Returns true if the path contains *, ?, or [ characters, or a {a,b} alternation.
 */
 func containsGlobPattern(path string) bool {
-	return strings.ContainsAny(path, "*?[")
+	if strings.ContainsAny(path, "*?[") {
+		return true
+	}
+	_, alternatives, ok := strings.Cut(path, "{")
+	return ok && strings.Contains(alternatives, ",")
 }
 
 /*
 isImageFile checks if the file has a supported image extension.
-Returns true if the file extension is one of: jpg, jpeg, png, gif, tiff, tif, bmp.
+Returns true if the file extension is one of: jpg, jpeg, png, gif, tiff, tif, bmp, webp.
 */
 func isImageFile(path string) bool {
 	ext := strings.ToLower(filepath.Ext(path))
 	return supportedImageExts[ext]
 }
 
+/*
+isImageInput reports whether path should be processed as an image: it has a
+supported image extension, or it has no extension at all and starts with the
+magic bytes of a supported format (uploads are often stored without one).
+*/
+func isImageInput(path string) bool {
+	if isImageFile(path) {
+		return true
+	}
+	if filepath.Ext(path) != "" {
+		return false
+	}
+	_, err := resize.DetectFileFormat(path)
+	return err == nil
+}
+
 /*
 expandGlobPattern expands a glob pattern and filters the results to only include image files.
+Besides "*", "?" and "[...]", "**" matches any number of directories (so
+"photos/**\/*.jpg" also finds photos/a.jpg and photos/2024/june/b.jpg) and
+"{jpg,png}" matches either alternative.
 Returns a slice of matching image file paths and any error encountered.
 */
 func expandGlobPattern(pattern string) ([]string, error) {
-	// Use filepath.Glob to expand the pattern
-	matches, err := filepath.Glob(pattern)
+	// Only regular files (not directories) are returned
+	matches, err := doublestar.FilepathGlob(pattern, doublestar.WithFilesOnly())
 	if err != nil {
-		return nil, fmt.Errorf("invalid glob pattern: %v", err)
+		return nil, fmt.Errorf("invalid glob pattern %q: %v", pattern, err)
 	}
 
 	// Filter to only include image files
 	var imageFiles []string
 	for _, match := range matches {
-		info, err := os.Stat(match)
-		if err != nil {
-			// Skip files that can't be accessed
+		if isImageInput(match) {
+			imageFiles = append(imageFiles, match)
+		}
+	}
+
+	return imageFiles, nil
+}
+
+/*
+expandArgs turns several command-line arguments into the image files to
+process. Glob patterns are expanded, other arguments must name image files
+(directories and other files are left out), and arguments starting with "!"
+are negation patterns that remove matching files and directories, e.g.
+"!photos/drafts" or "!thumb_*" (patterns without a slash match a file or
+directory name). Each file is listed once, in argument order.
+*/
+func expandArgs(args []string) ([]string, error) {
+	var files, negations []string
+	for _, arg := range args {
+		if pattern, ok := strings.CutPrefix(arg, "!"); ok && pattern != "" {
+			// A file whose name happens to start with "!" (e.g. from a shell-expanded glob)
+			if _, err := os.Lstat(arg); err != nil {
+				pattern = filepath.ToSlash(filepath.Clean(pattern))
+				if !doublestar.ValidatePattern(pattern) {
+					return nil, fmt.Errorf("invalid glob pattern %q", arg)
+				}
+				negations = append(negations, pattern)
+				continue
+			}
+		}
+
+		if containsGlobPattern(arg) {
+			matches, err := expandGlobPattern(arg)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
 			continue
 		}
 
-		// Only include regular files (not directories) that are image files
-		if !info.IsDir() && isImageFile(match) {
-			imageFiles = append(imageFiles, match)
+		info, err := os.Stat(arg)
+		if err != nil {
+			slog.Error(fmt.Sprintf("Cannot access file: %s, error: %v", arg, err))
+			continue
+		}
+		if !info.IsDir() && isImageInput(arg) {
+			files = append(files, arg)
 		}
 	}
 
+	seen := make(map[string]bool, len(files))
+	imageFiles := make([]string, 0, len(files))
+	for _, file := range files {
+		clean := filepath.Clean(file)
+		if seen[clean] || negated(negations, filepath.ToSlash(clean)) {
+			continue
+		}
+		seen[clean] = true
+		imageFiles = append(imageFiles, file)
+	}
 	return imageFiles, nil
 }
 
+// negated reports whether a negation pattern matches file or one of its parent directories.
+func negated(negations []string, file string) bool {
+	for p := file; p != "." && p != "/"; p = path.Dir(p) {
+		if matchesAny(negations, p) {
+			return true
+		}
+	}
+	return false
+}
+
 /*
 processMultipleFiles processes a pre-defined list of image files using a worker pool.
-Similar to processBatch but works with an explicit list rather than a directory walk.
+Similar to processBatch but works with an explicit list rather than a directory walk;
+their deepest common directory serves as the root mirrored under --output.
 */
-func processMultipleFiles(files []string) {
+func processMultipleFiles(ctx context.Context, files []string) batchSummary {
 	if verbose {
 		fmt.Printf("Processing %d files\n", len(files))
 	}
 
-	runWorkerPool(files)
+	return runWorkerPool(ctx, commonDir(files), files)
+}
+
+/*
+commonDir returns the deepest directory that contains all of files, or "" if
+there is none (for example when relative and absolute paths are mixed).
+*/
+func commonDir(files []string) string {
+	if len(files) == 0 {
+		return ""
+	}
+	dir := filepath.Dir(files[0])
+	for _, f := range files[1:] {
+		for !isWithin(dir, filepath.Dir(f)) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				return ""
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
+
+// isWithin reports whether path is dir or below it.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
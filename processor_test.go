@@ -1,14 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
 	"image"
 	"image/color"
+	"image/jpeg"
 	"image/png"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/appleboy/resize-tool/resize"
 	"github.com/spf13/cobra"
 )
 
@@ -42,19 +52,82 @@ func createTestImage(path string, width, height int) error {
 	return png.Encode(file, img)
 }
 
+// Helper function to resize a single image file with a resizer for the current flags
+func resizeImage(ctx context.Context, inputPath string, detailed bool) error {
+	resizer, err := newResizer("")
+	if err != nil {
+		return err
+	}
+	_, err = resizeVariants(ctx, resizer, inputPath, detailed)
+	return err
+}
+
+// Helper function to compute the target size for the current flags
+func calculateTargetSize(originalWidth, originalHeight int) (int, int) {
+	return resizeOptions().TargetSize(originalWidth, originalHeight)
+}
+
+// Helper function to compute the output path for the current flags and outputDir
+func generateOutputPath(inputPath, outputDir string, width, height int) string {
+	opts := resizeOptions()
+	opts.OutputDir = outputDir
+	return opts.OutputPath(inputPath, width, height)
+}
+
 // Helper function to reset global variables to default state
 func resetGlobals() {
 	width = 0
 	height = 0
 	quality = 95
+	lossless = false
 	outputDir = ""
 	keepRatio = false
+	mode = ""
+	anchor = "center"
+	bgColor = "white"
+	filter = "lanczos"
+	noOrient = false
+	metaMode = "strip"
+	format = ""
 	batchMode = false
 	workers = 4
 	verbose = false
 	overwrite = false
 	widthSet = false
 	heightSet = false
+	sizeList = ""
+	sizes = nil
+	scaleFlag = ""
+	scale = 0
+	maxSize = 0
+	minSize = 0
+	reportPath = ""
+	reportFormat = ""
+	allowErrorsValue = "0"
+	allowErrors = errorPolicy{}
+	failFast = false
+	backup = ""
+	skipExisting = false
+	incremental = false
+	stateFile = defaultStateFile
+	nameTmpl = resize.DefaultNameTemplate
+	dryRun = false
+	noUpscale = false
+	onlyEnlarge = false
+	shrinkLimit = ""
+	shrinkLargerThan = resize.Size{}
+	maxPixels = 0
+	maxInputBytes = 0
+	memoryBudget = defaultMemoryBudget
+	includeGenerated = false
+	fixExtension = false
+	toStdout = false
+	includes = nil
+	excludes = nil
+	maxDepth = -1
+	noRecursive = false
+	skipHidden = false
+	followSymlinks = false
 }
 
 func TestCalculateTargetSize(t *testing.T) {
@@ -119,6 +192,39 @@ func TestCalculateTargetSize(t *testing.T) {
 			expectedWidth:  50,
 			expectedHeight: 50,
 		},
+		{
+			name:           "Scale by percentage",
+			originalWidth:  800,
+			originalHeight: 600,
+			setupFlags: func() {
+				resetGlobals()
+				scale = 0.25
+			},
+			expectedWidth:  200,
+			expectedHeight: 150,
+		},
+		{
+			name:           "Max size on a portrait image",
+			originalWidth:  3000,
+			originalHeight: 4000,
+			setupFlags: func() {
+				resetGlobals()
+				maxSize = 2048
+			},
+			expectedWidth:  1536,
+			expectedHeight: 2048,
+		},
+		{
+			name:           "Min size on a landscape image",
+			originalWidth:  4000,
+			originalHeight: 3000,
+			setupFlags: func() {
+				resetGlobals()
+				minSize = 600
+			},
+			expectedWidth:  800,
+			expectedHeight: 600,
+		},
 	}
 
 	for _, tt := range tests {
@@ -347,7 +453,7 @@ func TestResizeImage(t *testing.T) {
 			tt.setupFlags()
 			imagePath := tt.setupImage()
 
-			err := resizeImage(imagePath, true)
+			err := resizeImage(context.Background(), imagePath, true)
 
 			if tt.expectError {
 				if err == nil {
@@ -397,7 +503,7 @@ func TestResizeImageKeepRatioZeroDimension(t *testing.T) {
 		t.Fatalf("Failed to create test image: %v", err)
 	}
 
-	if err := resizeImage(imagePath, true); err != nil {
+	if err := resizeImage(context.Background(), imagePath, true); err != nil {
 		t.Fatalf("resizeImage() returned error: %v", err)
 	}
 
@@ -716,6 +822,16 @@ func TestContainsGlobPattern(t *testing.T) {
 			path:     "photos/**/*.jpg",
 			expected: true,
 		},
+		{
+			name:     "pattern with alternatives",
+			path:     "images/*.{jpg,png}",
+			expected: true,
+		},
+		{
+			name:     "braces without alternatives",
+			path:     "images/photo{1}.png",
+			expected: false,
+		},
 		{
 			name:     "normal file path without pattern",
 			path:     "images/photo.png",
@@ -784,6 +900,11 @@ func TestIsImageFile(t *testing.T) {
 			path:     "photo.bmp",
 			expected: true,
 		},
+		{
+			name:     "WebP file",
+			path:     "photo.webp",
+			expected: true,
+		},
 		{
 			name:     "uppercase extension",
 			path:     "photo.PNG",
@@ -840,6 +961,9 @@ func TestExpandGlobPattern(t *testing.T) {
 		{filepath.Join(tempDir, "document.txt"), false},
 		{filepath.Join(tempDir, "photo1.gif"), true},
 		{filepath.Join(tempDir, "photo2.bmp"), true},
+		{filepath.Join(tempDir, "sub", "image4.png"), true},
+		{filepath.Join(tempDir, "sub", "deep", "image5.jpg"), true},
+		{filepath.Join(tempDir, "sub", "deep", "notes.txt"), false},
 	}
 
 	// Create the test files
@@ -893,6 +1017,30 @@ func TestExpandGlobPattern(t *testing.T) {
 			expectedCount: 2, // photo1.gif and photo2.bmp
 			expectError:   false,
 		},
+		{
+			name:          "recursive double star",
+			pattern:       filepath.Join(tempDir, "**", "*.jpg"),
+			expectedCount: 2, // image2.jpg and sub/deep/image5.jpg
+			expectError:   false,
+		},
+		{
+			name:          "recursive double star at the end",
+			pattern:       filepath.Join(tempDir, "sub", "**"),
+			expectedCount: 2, // Directories and notes.txt are left out
+			expectError:   false,
+		},
+		{
+			name:          "brace alternatives",
+			pattern:       filepath.Join(tempDir, "**", "*.{png,gif}"),
+			expectedCount: 3, // image1.png, photo1.gif and sub/image4.png
+			expectError:   false,
+		},
+		{
+			name:          "invalid pattern",
+			pattern:       filepath.Join(tempDir, "[*.png"),
+			expectedCount: 0,
+			expectError:   true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -922,6 +1070,68 @@ func TestExpandGlobPattern(t *testing.T) {
 	}
 }
 
+func TestExpandArgs(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.png", "thumb_a.jpg", "drafts/c.jpg", "2024/june/d.jpg"} {
+		if err := createTestImage(filepath.Join(tempDir, filepath.FromSlash(name)), 10, 10); err != nil {
+			t.Fatalf("Failed to create test image %s: %v", name, err)
+		}
+	}
+	path := func(name string) string { return filepath.Join(tempDir, filepath.FromSlash(name)) }
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name:     "plain files",
+			args:     []string{path("a.jpg"), path("b.png"), path("missing.jpg")},
+			expected: []string{"a.jpg", "b.png"},
+		},
+		{
+			name:     "files listed once",
+			args:     []string{path("*.jpg"), path("a.jpg")},
+			expected: []string{"a.jpg", "thumb_a.jpg"},
+		},
+		{
+			name:     "negated file name",
+			args:     []string{path("**/*.jpg"), "!thumb_*"},
+			expected: []string{"2024/june/d.jpg", "a.jpg", "drafts/c.jpg"},
+		},
+		{
+			name:     "negated directory",
+			args:     []string{path("**/*.{jpg,png}"), "!" + path("drafts/**"), "!" + path("2024")},
+			expected: []string{"a.jpg", "b.png", "thumb_a.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := expandArgs(tt.args)
+			if err != nil {
+				t.Fatalf("expandArgs() returned error: %v", err)
+			}
+			got := make([]string, len(files))
+			for i, f := range files {
+				rel, err := filepath.Rel(tempDir, f)
+				if err != nil {
+					t.Fatalf("Unexpected path %s: %v", f, err)
+				}
+				got[i] = filepath.ToSlash(rel)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("expandArgs() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := expandArgs([]string{path("a.jpg"), "![oops"}); err == nil {
+		t.Error("expandArgs() with an invalid negation pattern: expected error")
+	}
+}
+
 func TestProcessMultipleFiles(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -993,7 +1203,7 @@ func TestProcessMultipleFiles(t *testing.T) {
 				}
 			}()
 
-			processMultipleFiles(tt.files)
+			processMultipleFiles(context.Background(), tt.files)
 
 			// Verify output files were created (if not in overwrite mode)
 			if !overwrite {
@@ -1099,3 +1309,1099 @@ func TestProcessImagesWithGlobPattern(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessMultipleFilesKeepsMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Minimal big-endian EXIF block whose only IFD0 entry is a Copyright string
+	copyright := "ACME\x00\x00\x00\x00"
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01" +
+		"\x82\x98\x00\x02\x00\x00\x00\x08\x00\x00\x00\x1a\x00\x00\x00\x00" + copyright)
+	segment := append([]byte{0xff, 0xe1, 0x00, byte(len(exif) + 2)}, exif...)
+
+	var files []string
+	for _, name := range []string{"meta1.jpg", "meta2.jpg"} {
+		var buf bytes.Buffer
+		img := image.NewRGBA(image.Rect(0, 0, 100, 50))
+		if err := jpeg.Encode(&buf, img, nil); err != nil {
+			t.Fatalf("Failed to encode JPEG: %v", err)
+		}
+		data := append(append([]byte{0xff, 0xd8}, segment...), buf.Bytes()[2:]...)
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+		files = append(files, path)
+	}
+
+	for _, tt := range []struct {
+		mode     string
+		wantEXIF bool
+	}{
+		{"keep", true},
+		{"strip", false},
+	} {
+		t.Run(tt.mode, func(t *testing.T) {
+			resetGlobals()
+			width = 50
+			widthSet = true
+			metaMode = tt.mode
+			outputDir = filepath.Join(tempDir, tt.mode)
+
+			processMultipleFiles(context.Background(), files)
+
+			for _, input := range files {
+				name := strings.TrimSuffix(filepath.Base(input), ".jpg") + "_50x25.jpg"
+				out, err := os.ReadFile(filepath.Join(outputDir, name))
+				if err != nil {
+					t.Fatalf("Failed to read output: %v", err)
+				}
+				if got := bytes.Contains(out, []byte("ACME")); got != tt.wantEXIF {
+					t.Errorf("%s: copyright present = %v, want %v", name, got, tt.wantEXIF)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessBatchConvertsFormat(t *testing.T) {
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "scans")
+	for _, name := range []string{"a.png", "b.gif", "c.tiff"} {
+		if err := createTestImage(filepath.Join(inputDir, name), 60, 40); err != nil {
+			t.Fatalf("Failed to create test image %s: %v", name, err)
+		}
+	}
+
+	resetGlobals()
+	width = 30
+	widthSet = true
+	format = "jpeg"
+	outputDir = filepath.Join(tempDir, "out")
+
+	processBatch(context.Background(), inputDir)
+
+	for _, name := range []string{"a_30x20.jpg", "b_30x20.jpg", "c_30x20.jpg"} {
+		f, err := os.Open(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Errorf("Expected output %s: %v", name, err)
+			continue
+		}
+		_, decoded, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil || decoded != "jpeg" {
+			t.Errorf("%s decoded as %q (err %v), want jpeg", name, decoded, err)
+		}
+	}
+}
+
+func TestResizeImageWithSizes(t *testing.T) {
+	tempDir := t.TempDir()
+	imagePath := filepath.Join(tempDir, "srcset.png")
+	if err := createTestImage(imagePath, 640, 480); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	resetGlobals()
+	sizes = []resize.Size{{Width: 320}, {Width: 160}, {Width: 100, Height: 100}}
+
+	if err := resizeImage(context.Background(), imagePath, true); err != nil {
+		t.Fatalf("resizeImage() returned error: %v", err)
+	}
+
+	for _, name := range []string{"srcset_320x240.png", "srcset_160x120.png", "srcset_100x100.png"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Errorf("Expected output %s: %v", name, err)
+		}
+	}
+}
+
+func TestProcessBatchWritesReport(t *testing.T) {
+	tests := []struct {
+		name       string
+		reportFile string
+		format     string
+	}{
+		{name: "json from extension", reportFile: "report.json"},
+		{name: "csv from extension", reportFile: "report.csv"},
+		{name: "explicit csv", reportFile: "report.txt", format: "csv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			inputDir := filepath.Join(tempDir, "photos")
+			if err := createTestImage(filepath.Join(inputDir, "a.png"), 60, 40); err != nil {
+				t.Fatalf("Failed to create test image: %v", err)
+			}
+			// Not a decodable image, so it is reported with an error
+			if err := os.WriteFile(filepath.Join(inputDir, "b.png"), []byte("junk"), 0o600); err != nil {
+				t.Fatalf("Failed to create broken image: %v", err)
+			}
+
+			resetGlobals()
+			width = 30
+			widthSet = true
+			outputDir = filepath.Join(tempDir, "out")
+			reportPath = filepath.Join(tempDir, tt.reportFile)
+			f, err := resolveReportFormat(reportPath, tt.format)
+			if err != nil {
+				t.Fatalf("resolveReportFormat() error = %v", err)
+			}
+			reportFormat = f
+
+			processBatch(context.Background(), inputDir)
+
+			data, err := os.ReadFile(reportPath)
+			if err != nil {
+				t.Fatalf("Expected report file: %v", err)
+			}
+
+			var entries []reportEntry
+			if reportFormat == reportJSON {
+				var r report
+				if err := json.Unmarshal(data, &r); err != nil {
+					t.Fatalf("Invalid JSON report: %v", err)
+				}
+				if r.Success != 1 || r.Errors != 1 {
+					t.Errorf("Summary = %d success, %d errors, want 1, 1", r.Success, r.Errors)
+				}
+				entries = r.Files
+			} else {
+				rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+				if err != nil {
+					t.Fatalf("Invalid CSV report: %v", err)
+				}
+				if len(rows) != 3 || strings.Join(rows[0], ",") != strings.Join(reportCSVHeader, ",") {
+					t.Fatalf("CSV rows = %v, want header and 2 rows", rows)
+				}
+				for _, row := range rows[1:] {
+					inputBytes, _ := strconv.ParseInt(row[6], 10, 64)
+					entries = append(entries, reportEntry{
+						Input: row[0], Output: row[1], InputBytes: inputBytes, Error: row[9],
+					})
+				}
+			}
+
+			if len(entries) != 2 {
+				t.Fatalf("Report has %d entries, want 2", len(entries))
+			}
+			ok, failed := entries[0], entries[1]
+			if filepath.Base(ok.Input) != "a.png" || filepath.Base(ok.Output) != "a_30x20.png" || ok.Error != "" {
+				t.Errorf("Unexpected success entry: %+v", ok)
+			}
+			if reportFormat == reportJSON {
+				if ok.OriginalWidth != 60 || ok.OriginalHeight != 40 || ok.Width != 30 || ok.Height != 20 {
+					t.Errorf("Unexpected dimensions: %+v", ok)
+				}
+				if ok.InputBytes == 0 || ok.OutputBytes == 0 {
+					t.Errorf("Expected byte sizes to be recorded: %+v", ok)
+				}
+			}
+			if filepath.Base(failed.Input) != "b.png" || failed.Output != "" || failed.Error == "" {
+				t.Errorf("Unexpected error entry: %+v", failed)
+			}
+			if failed.InputBytes != int64(len("junk")) {
+				t.Errorf("Error entry input bytes = %d, want %d", failed.InputBytes, len("junk"))
+			}
+		})
+	}
+}
+
+func TestResolveReportFormat(t *testing.T) {
+	tests := []struct {
+		path    string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{path: "out/report.json", want: reportJSON},
+		{path: "out/REPORT.CSV", want: reportCSV},
+		{path: "report", want: reportJSON},
+		{path: "report.json", format: "CSV", want: reportCSV},
+		{path: "report.csv", format: "json", want: reportJSON},
+		{path: "report.xml", format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := resolveReportFormat(tt.path, tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveReportFormat(%q, %q) error = %v, wantErr %v", tt.path, tt.format, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolveReportFormat(%q, %q) = %q, want %q", tt.path, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		failed  int
+		total   int
+		allowed bool
+		wantErr bool
+	}{
+		{value: "0", failed: 0, total: 10, allowed: true},
+		{value: "0", failed: 1, total: 10, allowed: false},
+		{value: "3", failed: 3, total: 10, allowed: true},
+		{value: "3", failed: 4, total: 10, allowed: false},
+		{value: "10%", failed: 1, total: 10, allowed: true},
+		{value: "10%", failed: 2, total: 10, allowed: false},
+		{value: "2.5%", failed: 1, total: 40, allowed: true},
+		{value: "100%", failed: 10, total: 10, allowed: true},
+		{value: "-1", wantErr: true},
+		{value: "1.5", wantErr: true},
+		{value: "101%", wantErr: true},
+		{value: "some", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		p, err := parseErrorPolicy(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseErrorPolicy(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if p.String() != tt.value {
+			t.Errorf("parseErrorPolicy(%q).String() = %q", tt.value, p.String())
+		}
+		if got := p.allows(tt.failed, tt.total); got != tt.allowed {
+			t.Errorf("parseErrorPolicy(%q).allows(%d, %d) = %v, want %v",
+				tt.value, tt.failed, tt.total, got, tt.allowed)
+		}
+	}
+}
+
+func TestRunWorkerPoolFailFast(t *testing.T) {
+	tempDir := t.TempDir()
+	var files []string
+	for i := range 5 {
+		path := filepath.Join(tempDir, fmt.Sprintf("broken%d.png", i))
+		if err := os.WriteFile(path, []byte("junk"), 0o600); err != nil {
+			t.Fatalf("Failed to create broken image: %v", err)
+		}
+		files = append(files, path)
+	}
+
+	tests := []struct {
+		name      string
+		failFast  bool
+		allow     string
+		wantError int
+	}{
+		{name: "without fail-fast every file is tried", failFast: false, allow: "0", wantError: 5},
+		{name: "fail-fast stops at the first error", failFast: true, allow: "0", wantError: 1},
+		{name: "fail-fast honors allowed errors", failFast: true, allow: "2", wantError: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGlobals()
+			width = 30
+			widthSet = true
+			workers = 1
+			failFast = tt.failFast
+			policy, err := parseErrorPolicy(tt.allow)
+			if err != nil {
+				t.Fatalf("parseErrorPolicy() error = %v", err)
+			}
+			allowErrors = policy
+
+			summary := runWorkerPool(context.Background(), "", files)
+
+			if summary.errors != tt.wantError || summary.success != 0 {
+				t.Errorf("Summary = %+v, want %d errors", summary, tt.wantError)
+			}
+			if summary.canceled != len(files)-tt.wantError {
+				t.Errorf("Canceled = %d, want %d", summary.canceled, len(files)-tt.wantError)
+			}
+		})
+	}
+}
+
+func TestRunWorkerPoolInterrupted(t *testing.T) {
+	tempDir := t.TempDir()
+	var files []string
+	for i := range 3 {
+		path := filepath.Join(tempDir, fmt.Sprintf("img%d.png", i))
+		if err := createTestImage(path, 60, 40); err != nil {
+			t.Fatalf("Failed to create test image: %v", err)
+		}
+		files = append(files, path)
+	}
+
+	resetGlobals()
+	width = 30
+	widthSet = true
+	outputDir = filepath.Join(tempDir, "out")
+	reportPath = filepath.Join(tempDir, "report.json")
+	reportFormat = reportJSON
+
+	// An already canceled context behaves like Ctrl-C before the first job
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary := runWorkerPool(ctx, "", files)
+
+	if !summary.interrupted || summary.canceled != len(files) || summary.errors != 0 {
+		t.Errorf("Summary = %+v, want all %d files canceled", summary, len(files))
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("Expected no output to be written, stat error = %v", err)
+	}
+
+	// The partial report is still written, with no entries
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Expected report file: %v", err)
+	}
+	var r report
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("Invalid JSON report: %v", err)
+	}
+	if len(r.Files) != 0 {
+		t.Errorf("Report has %d entries, want 0", len(r.Files))
+	}
+}
+
+func TestRunWorkerPoolSkipExisting(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{filepath.Join(tempDir, "a.png"), filepath.Join(tempDir, "b.png")}
+	for _, path := range files {
+		if err := createTestImage(path, 60, 40); err != nil {
+			t.Fatalf("Failed to create test image: %v", err)
+		}
+	}
+
+	resetGlobals()
+	width = 30
+	widthSet = true
+	outputDir = filepath.Join(tempDir, "out")
+	skipExisting = true
+
+	// Only b has an output already
+	if err := createTestImage(filepath.Join(outputDir, "b_30x20.png"), 30, 20); err != nil {
+		t.Fatalf("Failed to create existing output: %v", err)
+	}
+
+	summary := runWorkerPool(context.Background(), "", files)
+	if summary.success != 1 || summary.skipped != 1 || summary.errors != 0 {
+		t.Errorf("Summary = %+v, want 1 success and 1 skipped", summary)
+	}
+
+	summary = runWorkerPool(context.Background(), "", files)
+	if summary.success != 0 || summary.skipped != 2 {
+		t.Errorf("Second run summary = %+v, want 2 skipped", summary)
+	}
+}
+
+func TestRunWorkerPoolIncremental(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{filepath.Join(tempDir, "a.png"), filepath.Join(tempDir, "b.png")}
+	for _, path := range files {
+		if err := createTestImage(path, 60, 40); err != nil {
+			t.Fatalf("Failed to create test image: %v", err)
+		}
+	}
+
+	resetGlobals()
+	width = 30
+	widthSet = true
+	outputDir = filepath.Join(tempDir, "out")
+	incremental = true
+	stateFile = filepath.Join(tempDir, "state", "state.json")
+
+	run := func(wantSuccess, wantSkipped int) {
+		t.Helper()
+		summary := runWorkerPool(context.Background(), "", files)
+		if summary.success != wantSuccess || summary.skipped != wantSkipped || summary.errors != 0 {
+			t.Errorf("Summary = %+v, want %d success and %d skipped", summary, wantSuccess, wantSkipped)
+		}
+	}
+
+	run(2, 0)
+	run(0, 2)
+
+	// Touching a file without changing its content is recognized by its hash
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(files[0], later, later); err != nil {
+		t.Fatalf("Failed to touch file: %v", err)
+	}
+	run(0, 2)
+
+	// Changing the content reprocesses only that file
+	if err := createTestImage(files[1], 80, 40); err != nil {
+		t.Fatalf("Failed to rewrite test image: %v", err)
+	}
+	run(1, 1)
+
+	// A deleted output is regenerated
+	if err := os.Remove(filepath.Join(outputDir, "a_30x20.png")); err != nil {
+		t.Fatalf("Failed to remove output: %v", err)
+	}
+	run(1, 1)
+
+	// Different settings reprocess everything
+	quality = 80
+	run(2, 0)
+}
+
+func TestProcessBatchMirrorsDirectoryTree(t *testing.T) {
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "products")
+	for _, name := range []string{"logo.png", "a/logo.png", "b/c/logo.png"} {
+		if err := createTestImage(filepath.Join(inputDir, name), 60, 40); err != nil {
+			t.Fatalf("Failed to create test image %s: %v", name, err)
+		}
+	}
+
+	resetGlobals()
+	width = 30
+	widthSet = true
+	outputDir = filepath.Join(tempDir, "out")
+
+	summary := processBatch(context.Background(), inputDir)
+	if summary.success != 3 {
+		t.Fatalf("Summary = %+v, want 3 success", summary)
+	}
+	for _, name := range []string{"logo_30x20.png", "a/logo_30x20.png", "b/c/logo_30x20.png"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); err != nil {
+			t.Errorf("Expected mirrored output %s: %v", name, err)
+		}
+	}
+}
+
+func TestProcessBatchBackupMirrorsDirectoryTree(t *testing.T) {
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "t1")
+	names := []string{"a/logo.png", "b/logo.png"}
+	for _, name := range names {
+		if err := createTestImage(filepath.Join(inputDir, name), 60, 40); err != nil {
+			t.Fatalf("Failed to create test image %s: %v", name, err)
+		}
+	}
+
+	resetGlobals()
+	width = 30
+	widthSet = true
+	overwrite = true
+	backup = filepath.Join(tempDir, "bak") + string(filepath.Separator)
+
+	summary := processBatch(context.Background(), inputDir)
+	if summary.success != 2 {
+		t.Fatalf("Summary = %+v, want 2 success", summary)
+	}
+	// Both originals are kept, each at its own place below the backup directory
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(tempDir, "bak", name))
+		if err != nil {
+			t.Errorf("Expected backup %s: %v", name, err)
+			continue
+		}
+		cfg, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil || cfg.Width != 60 {
+			t.Errorf("Backup %s is not the 60px original: %+v, %v", name, cfg, err)
+		}
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"single file", []string{"a/b/x.png"}, "a/b"},
+		{"same directory", []string{"a/b/x.png", "a/b/y.png"}, "a/b"},
+		{"sibling directories", []string{"a/b/x.png", "a/c/y.png"}, "a"},
+		{"nested", []string{"a/x.png", "a/b/c/y.png"}, "a"},
+		{"relative roots", []string{"a/x.png", "b/y.png"}, "."},
+		{"mixed absolute and relative", []string{"/a/x.png", "b/y.png"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []string
+			for _, f := range tt.files {
+				files = append(files, filepath.FromSlash(f))
+			}
+			if got := commonDir(files); got != filepath.FromSlash(tt.want) {
+				t.Errorf("commonDir(%v) = %q, want %q", tt.files, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindCollisions(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{
+		filepath.Join(tempDir, "logo.png"),
+		filepath.Join(tempDir, "logo.gif"),
+		filepath.Join(tempDir, "other.png"),
+	}
+	for _, path := range files {
+		if err := createTestImage(path, 60, 40); err != nil {
+			t.Fatalf("Failed to create test image: %v", err)
+		}
+	}
+
+	resetGlobals()
+	width = 30
+	widthSet = true
+
+	resizer, err := newResizer("")
+	if err != nil {
+		t.Fatalf("newResizer() error = %v", err)
+	}
+	if collisions := findCollisions(resizer, files); len(collisions) != 0 {
+		t.Errorf("Expected no collisions without --format, got %+v", collisions)
+	}
+
+	// Converting both logos to JPEG maps them to the same output
+	format = "jpeg"
+	resizer, err = newResizer("")
+	if err != nil {
+		t.Fatalf("newResizer() error = %v", err)
+	}
+	collisions := findCollisions(resizer, files)
+	if len(collisions) != 1 {
+		t.Fatalf("Expected 1 collision, got %+v", collisions)
+	}
+	if want := filepath.Join(tempDir, "logo_30x20.jpg"); collisions[0].output != want ||
+		len(collisions[0].inputs) != 2 {
+		t.Errorf("Collision = %+v, want %s from both logos", collisions[0], want)
+	}
+
+	// Originals with the same name outside the input root share a backup
+	resetGlobals()
+	width = 30
+	widthSet = true
+	overwrite = true
+	backup = filepath.Join(tempDir, "bak") + string(filepath.Separator)
+	other := filepath.Join(tempDir, "other", "logo.png")
+	if err := createTestImage(other, 60, 40); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	resizer, err = newResizer("")
+	if err != nil {
+		t.Fatalf("newResizer() error = %v", err)
+	}
+	collisions = findCollisions(resizer, []string{files[0], other})
+	if want := filepath.Join(tempDir, "bak", "logo.png"); len(collisions) != 1 || collisions[0].output != want {
+		t.Errorf("Collisions = %+v, want one on %s", collisions, want)
+	}
+
+	// Two sizes of one input that the template names the same way
+	resetGlobals()
+	sizes = []resize.Size{{Height: 20}, {Width: 30, Height: 10}}
+	nameTmpl = "{name}_{w}{ext}"
+	resizer, err = newResizer("")
+	if err != nil {
+		t.Fatalf("newResizer() error = %v", err)
+	}
+	collisions = findCollisions(resizer, files[2:])
+	if want := filepath.Join(tempDir, "other_30.png"); len(collisions) != 1 || collisions[0].output != want {
+		t.Errorf("Collisions = %+v, want one on %s", collisions, want)
+	}
+}
+
+// Helper function to capture what fn prints to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureOutput(t, &os.Stdout, fn)
+}
+
+// Helper function to capture what fn prints to stderr
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureOutput(t, &os.Stderr, fn)
+}
+
+// Helper function to capture what fn writes to *file (os.Stdout or os.Stderr)
+func captureOutput(t *testing.T, file **os.File, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	saved := *file
+	*file = w
+	defer func() { *file = saved }()
+
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(r)
+		done <- buf.String()
+	}()
+
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestRunWorkerPoolDryRun(t *testing.T) {
+	tempDir := t.TempDir()
+	inputDir := filepath.Join(tempDir, "photos")
+	files := []string{
+		filepath.Join(inputDir, "large.png"),
+		filepath.Join(inputDir, "icon.png"),
+		filepath.Join(inputDir, "broken.png"),
+	}
+	if err := createTestImage(files[0], 200, 100); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	if err := createTestImage(files[1], 50, 50); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	if err := os.WriteFile(files[2], []byte("junk"), 0o600); err != nil {
+		t.Fatalf("Failed to create broken image: %v", err)
+	}
+
+	resetGlobals()
+	width = 100
+	widthSet = true
+	outputDir = filepath.Join(tempDir, "out")
+	dryRun = true
+
+	var summary batchSummary
+	output := captureStdout(t, func() {
+		summary = runWorkerPool(context.Background(), inputDir, files)
+	})
+
+	if summary.success != 2 || summary.errors != 1 {
+		t.Errorf("Summary = %+v, want 2 planned and 1 error", summary)
+	}
+	if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+		t.Errorf("Dry run must not write anything, stat error = %v", err)
+	}
+
+	wantLines := []string{
+		files[0] + " (200x100) -> " + filepath.Join(outputDir, "large_100x50.png") + " (100x50)\n",
+		files[1] + " (50x50) -> " + filepath.Join(outputDir, "icon_100x100.png") + " (100x100) [upscale]\n",
+		files[2] + ": error: ",
+	}
+	for _, want := range wantLines {
+		if !strings.Contains(output, want) {
+			t.Errorf("Dry run output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestRunWorkerPoolNoUpscale(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{filepath.Join(tempDir, "photo.png"), filepath.Join(tempDir, "icon.png")}
+	if err := createTestImage(files[0], 1200, 800); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	if err := createTestImage(files[1], 300, 300); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	resetGlobals()
+	width = 800
+	widthSet = true
+	noUpscale = true
+	reportPath = filepath.Join(tempDir, "report.json")
+	reportFormat = reportJSON
+
+	summary := runWorkerPool(context.Background(), "", files)
+	if summary.success != 1 || summary.skipped != 1 || summary.errors != 0 || summary.canceled != 0 {
+		t.Errorf("Summary = %+v, want 1 success and 1 skipped", summary)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "icon_800x800.png")); !os.IsNotExist(err) {
+		t.Errorf("Small image must not be upscaled, stat error = %v", err)
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Expected report file: %v", err)
+	}
+	var r report
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("Invalid JSON report: %v", err)
+	}
+	if r.Skipped != 1 || len(r.Files) != 2 || r.Files[1].Skipped != "already within bounds" {
+		t.Errorf("Report = %+v, want icon.png skipped as already within bounds", r)
+	}
+}
+
+func TestRunWorkerPoolMaxPixels(t *testing.T) {
+	tempDir := t.TempDir()
+	files := []string{filepath.Join(tempDir, "small.png"), filepath.Join(tempDir, "large.png")}
+	if err := createTestImage(files[0], 200, 100); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	if err := createTestImage(files[1], 1200, 800); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	resetGlobals()
+	width = 100
+	widthSet = true
+	maxPixels = 500_000
+	allowErrors = errorPolicy{limit: 1}
+
+	summary := runWorkerPool(context.Background(), "", files)
+	if summary.success != 1 || summary.errors != 1 {
+		t.Errorf("Summary = %+v, want 1 success and 1 error", summary)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "large_100x67.png")); !os.IsNotExist(err) {
+		t.Errorf("Image over --max-pixels must not be resized, stat error = %v", err)
+	}
+}
+
+func TestProcessBatchExcludesGenerated(t *testing.T) {
+	tests := []struct {
+		name             string
+		inputs           []string
+		includeGenerated bool
+		fixExtension     bool
+		wantFirst        int
+		wantSuccess      int
+		doubled          string // Output of an output, only written if generated files are processed
+	}{
+		// banner_60x40.png only looks generated: there is no banner image next to it
+		{"excluded by default", []string{"photo.png", "banner_60x40.png"}, false, false, 2, 2, "photo_30x20_30x20.png"},
+		{"included on request", []string{"photo.png", "banner_60x40.png"}, true, false, 2, 4, "photo_30x20_30x20.png"},
+		// Uploads stored without an extension produce outputs without one
+		{"without extension", []string{"upload123"}, false, false, 1, 1, "upload123_30x20_30x20"},
+		{"without extension, fixed", []string{"upload123"}, false, true, 1, 1, "upload123_30x20_30x20.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			for _, name := range tt.inputs {
+				if err := createTestImage(filepath.Join(tempDir, name), 60, 40); err != nil {
+					t.Fatalf("Failed to create test image %s: %v", name, err)
+				}
+			}
+
+			resetGlobals()
+			width = 30
+			widthSet = true
+			includeGenerated = tt.includeGenerated
+			fixExtension = tt.fixExtension
+
+			// The first run writes photo_30x20.png and banner_60x40_30x20.png (or upload123_30x20)
+			if summary := processBatch(context.Background(), tempDir); summary.success != tt.wantFirst {
+				t.Fatalf("First run summary = %+v, want %d success", summary, tt.wantFirst)
+			}
+			summary := processBatch(context.Background(), tempDir)
+			if summary.success != tt.wantSuccess {
+				t.Errorf("Second run summary = %+v, want %d success", summary, tt.wantSuccess)
+			}
+			_, err := os.Stat(filepath.Join(tempDir, tt.doubled))
+			if exists := err == nil; exists != tt.includeGenerated {
+				t.Errorf("%s exists = %v, want %v", tt.doubled, exists, tt.includeGenerated)
+			}
+		})
+	}
+}
+
+func TestCollectImageFilesWalkOptions(t *testing.T) {
+	tempDir := t.TempDir()
+	root := filepath.Join(tempDir, "root")
+	outside := filepath.Join(tempDir, "outside")
+	for _, name := range []string{
+		"root/a.jpg",
+		"root/.c.jpg",
+		"root/notes.txt",
+		"root/.hidden/b.jpg",
+		"root/sub/d.png",
+		"root/sub/deep/e.jpg",
+		"root/node_modules/f.jpg",
+		"outside/g.jpg",
+	} {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	// ext leads out of the tree, sub-link back into it and outside/back to the root
+	for link, target := range map[string]string{
+		filepath.Join(root, "ext"):      outside,
+		filepath.Join(root, "sub-link"): filepath.Join(root, "sub"),
+		filepath.Join(outside, "back"):  root,
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		setupFlags func()
+		expected   []string
+	}{
+		{
+			name:       "Everything",
+			setupFlags: func() {},
+			expected: []string{
+				".c.jpg", ".hidden/b.jpg", "a.jpg", "node_modules/f.jpg", "sub/d.png", "sub/deep/e.jpg",
+			},
+		},
+		{
+			name:       "Skip hidden",
+			setupFlags: func() { skipHidden = true },
+			expected:   []string{"a.jpg", "node_modules/f.jpg", "sub/d.png", "sub/deep/e.jpg"},
+		},
+		{
+			name:       "Exclude directory",
+			setupFlags: func() { excludes = []string{"node_modules", ".hidden"} },
+			expected:   []string{".c.jpg", "a.jpg", "sub/d.png", "sub/deep/e.jpg"},
+		},
+		{
+			name:       "Include extension",
+			setupFlags: func() { includes = []string{"*.png"} },
+			expected:   []string{"sub/d.png"},
+		},
+		{
+			name:       "Include relative path",
+			setupFlags: func() { includes = []string{"sub/*/*.jpg"} },
+			expected:   []string{"sub/deep/e.jpg"},
+		},
+		{
+			name:       "No recursion",
+			setupFlags: func() { maxDepth = 0 },
+			expected:   []string{".c.jpg", "a.jpg"},
+		},
+		{
+			name:       "Max depth",
+			setupFlags: func() { maxDepth = 1; skipHidden = true },
+			expected:   []string{"a.jpg", "node_modules/f.jpg", "sub/d.png"},
+		},
+		{
+			name: "Follow symlinks",
+			setupFlags: func() {
+				followSymlinks = true
+				skipHidden = true
+				excludes = []string{"node_modules"}
+			},
+			// sub-link and outside/back lead into trees that are already walked
+			expected: []string{"a.jpg", "ext/g.jpg", "sub/d.png", "sub/deep/e.jpg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGlobals()
+			tt.setupFlags()
+
+			files, err := collectImageFiles(root)
+			if err != nil {
+				t.Fatalf("collectImageFiles() returned error: %v", err)
+			}
+			got := make([]string, len(files))
+			for i, f := range files {
+				rel, err := filepath.Rel(root, f)
+				if err != nil {
+					t.Fatalf("Unexpected path %s: %v", f, err)
+				}
+				got[i] = filepath.ToSlash(rel)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("collectImageFiles() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProcessBatchDetectsFormat(t *testing.T) {
+	tempDir := t.TempDir()
+	// Both are PNGs: one without an extension, one with the wrong one
+	for _, name := range []string{"upload", "photo.jpg"} {
+		if err := createTestImage(filepath.Join(tempDir, name), 60, 40); err != nil {
+			t.Fatalf("Failed to create test image %s: %v", name, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "README"), []byte("not an image"), 0o644); err != nil {
+		t.Fatalf("Failed to create README: %v", err)
+	}
+
+	resetGlobals()
+	width = 30
+	widthSet = true
+	fixExtension = true
+	reportPath = filepath.Join(tempDir, "report", "report.json")
+	reportFormat = reportJSON
+
+	summary := processBatch(context.Background(), tempDir)
+	if summary.success != 2 || summary.errors != 0 {
+		t.Fatalf("Summary = %+v, want 2 success", summary)
+	}
+	for _, name := range []string{"upload_30x20.png", "photo_30x20.png"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Errorf("Expected output %s named after its content: %v", name, err)
+		}
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatalf("Expected report file: %v", err)
+	}
+	var r report
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatalf("Invalid JSON report: %v", err)
+	}
+	warnings := map[string]string{}
+	for _, e := range r.Files {
+		warnings[filepath.Base(e.Input)] = e.Warning
+	}
+	if warnings["upload"] != "content is png but the file has no extension" ||
+		warnings["photo.jpg"] != "content is png but the extension is .jpg" {
+		t.Errorf("Report warnings = %v", warnings)
+	}
+}
+
+func TestResizeStream(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "photo.png")
+	if err := createTestImage(inputPath, 60, 40); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	original, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read test image: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		setupFlags  func()
+		stdin       bool
+		wantFormat  string
+		wantWidth   int
+		passThrough bool
+	}{
+		{"file to stdout", func() { width = 30; widthSet = true }, false, "png", 30, false},
+		{"stdin to stdout", func() { width = 30; widthSet = true }, true, "png", 30, false},
+		{"format override", func() { width = 30; widthSet = true; format = "jpg" }, true, "jpeg", 30, false},
+		{"single size", func() { sizes = []resize.Size{{Width: 15}} }, true, "png", 15, false},
+		{"within bounds", func() { width = 120; widthSet = true; noUpscale = true }, true, "png", 60, true},
+		{
+			"within bounds, format override",
+			func() { width = 120; widthSet = true; noUpscale = true; format = "jpg" },
+			true, "jpeg", 60, false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGlobals()
+			toStdout = true
+			tt.setupFlags()
+
+			input := inputPath
+			if tt.stdin {
+				f, err := os.Open(inputPath)
+				if err != nil {
+					t.Fatalf("Failed to open test image: %v", err)
+				}
+				defer f.Close()
+				stdin := os.Stdin
+				os.Stdin = f
+				defer func() { os.Stdin = stdin }()
+				input = stdinArg
+			}
+
+			var streamErr error
+			out := captureStdout(t, func() { streamErr = resizeStream(context.Background(), input) })
+			if streamErr != nil {
+				t.Fatalf("resizeStream() returned error: %v", streamErr)
+			}
+
+			cfg, name, err := image.DecodeConfig(strings.NewReader(out))
+			if err != nil {
+				t.Fatalf("stdout is not an image: %v", err)
+			}
+			if name != tt.wantFormat || cfg.Width != tt.wantWidth {
+				t.Errorf("stdout = %s %dpx wide, want %s %dpx", name, cfg.Width, tt.wantFormat, tt.wantWidth)
+			}
+			if tt.passThrough && out != string(original) {
+				t.Error("image within bounds was not passed through unchanged")
+			}
+		})
+	}
+
+	// No file is written next to the input
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read temp directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("resizeStream() left %d files in the input directory, want only the input", len(entries))
+	}
+}
+
+func TestValidateStream(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		setupFlags func()
+		wantErr    bool
+	}{
+		{"no streaming", []string{"a.jpg", "b.jpg"}, func() {}, false},
+		{"stdin with --stdout", []string{"-"}, func() { toStdout = true }, false},
+		{"file with --stdout", []string{"a.jpg"}, func() { toStdout = true }, false},
+		{"stdin without --stdout", []string{"-"}, func() {}, true},
+		{"several inputs", []string{"a.jpg", "b.jpg"}, func() { toStdout = true }, true},
+		{"batch", []string{"photos"}, func() { toStdout = true; batchMode = true }, true},
+		{"several sizes", []string{"-"}, func() { toStdout = true; sizes = []resize.Size{{Width: 1}, {Width: 2}} }, true},
+		{"overwrite", []string{"a.jpg"}, func() { toStdout = true; overwrite = true }, true},
+		{"output", []string{"-"}, func() { toStdout = true; outputDir = "out" }, true},
+		{"report", []string{"-"}, func() { toStdout = true; reportPath = "report.json" }, true},
+		{"dry run", []string{"-"}, func() { toStdout = true; dryRun = true }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGlobals()
+			tt.setupFlags()
+			if err := validateStream(tt.args); (err != nil) != tt.wantErr {
+				t.Errorf("validateStream(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResizeVariantsWarnsAboutExtension(t *testing.T) {
+	tempDir := t.TempDir()
+	// A PNG saved with a JPEG extension
+	inputPath := filepath.Join(tempDir, "photo.jpg")
+	if err := createTestImage(inputPath, 60, 40); err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+
+	resetGlobals()
+	width = 30
+	widthSet = true
+
+	stderr := captureStderr(t, func() {
+		if err := resizeImage(context.Background(), inputPath, false); err != nil {
+			t.Errorf("resizeImage() returned error: %v", err)
+		}
+	})
+	if !strings.Contains(stderr, "Warning: "+inputPath+": content is png but the extension is .jpg") {
+		t.Errorf("stderr = %q, want the extension warning", stderr)
+	}
+
+	fixExtension = true
+	stderr = captureStderr(t, func() {
+		if err := resizeImage(context.Background(), inputPath, false); err != nil {
+			t.Errorf("resizeImage() returned error: %v", err)
+		}
+	})
+	if stderr != "" {
+		t.Errorf("stderr with --fix-extension = %q, want no warning", stderr)
+	}
+}
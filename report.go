@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Supported --report-format values.
+const (
+	reportJSON = "json"
+	reportCSV  = "csv"
+)
+
+// reportEntry is one row of the --report output: a written or failed output file.
+type reportEntry struct {
+	Input          string  `json:"input"`
+	Output         string  `json:"output"`
+	OriginalWidth  int     `json:"original_width"`
+	OriginalHeight int     `json:"original_height"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	InputBytes     int64   `json:"input_bytes"`
+	OutputBytes    int64   `json:"output_bytes"`
+	DurationMS     float64 `json:"duration_ms"`
+	Error          string  `json:"error,omitempty"`
+	Skipped        string  `json:"skipped,omitempty"`
+	Warning        string  `json:"warning,omitempty"`
+}
+
+// report is the document written by --report.
+type report struct {
+	Success int           `json:"success"`
+	Errors  int           `json:"errors"`
+	Skipped int           `json:"skipped"`
+	Files   []reportEntry `json:"files"`
+}
+
+// reportCSVHeader is the header row of CSV reports, matching reportEntry.
+var reportCSVHeader = []string{
+	"input", "output", "original_width", "original_height", "width", "height",
+	"input_bytes", "output_bytes", "duration_ms", "error", "skipped", "warning",
+}
+
+/*
+resolveReportFormat returns the report format to use: the --report-format
+value if given, otherwise csv for a .csv report path and json for anything else.
+*/
+func resolveReportFormat(path, format string) (string, error) {
+	switch strings.ToLower(format) {
+	case reportJSON:
+		return reportJSON, nil
+	case reportCSV:
+		return reportCSV, nil
+	case "":
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			return reportCSV, nil
+		}
+		return reportJSON, nil
+	default:
+		return "", fmt.Errorf("invalid report format %q (valid: json, csv)", format)
+	}
+}
+
+/*
+buildReport turns per-file outcomes into report rows. A file that produced
+several outputs (--sizes) yields one row per output; a failed or skipped file
+yields a single row carrying the error message or skip reason. Failed files
+still report the size of the input, read from the file system.
+*/
+func buildReport(records []fileResult) report {
+	r := report{Files: []reportEntry{}}
+	for _, rec := range records {
+		durationMS := float64(rec.duration.Microseconds()) / 1000
+
+		if rec.skipped != "" {
+			r.Skipped++
+			r.Files = append(r.Files, reportEntry{Input: rec.path, Skipped: rec.skipped})
+			continue
+		}
+
+		if rec.err != nil {
+			r.Errors++
+			entry := reportEntry{
+				Input:      rec.path,
+				DurationMS: durationMS,
+				Error:      rec.err.Error(),
+			}
+			if info, err := os.Stat(rec.path); err == nil && info.Mode().IsRegular() {
+				entry.InputBytes = info.Size()
+			}
+			r.Files = append(r.Files, entry)
+			continue
+		}
+
+		r.Success++
+		for _, res := range rec.results {
+			r.Files = append(r.Files, reportEntry{
+				Input:          rec.path,
+				Output:         res.OutputPath,
+				OriginalWidth:  res.OriginalWidth,
+				OriginalHeight: res.OriginalHeight,
+				Width:          res.Width,
+				Height:         res.Height,
+				InputBytes:     res.InputSize,
+				OutputBytes:    res.OutputSize,
+				DurationMS:     durationMS,
+				Warning:        extensionWarning(rec.path, res.InputFormat),
+			})
+		}
+	}
+	return r
+}
+
+// writeReport writes the --report file for the given outcomes, if one was requested.
+func writeReport(records []fileResult) error {
+	if reportPath == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(reportPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create report directory: %v", err)
+	}
+	f, err := os.Create(reportPath)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %v", err)
+	}
+	defer f.Close()
+
+	r := buildReport(records)
+	if reportFormat == reportCSV {
+		err = writeCSVReport(f, r)
+	} else {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+
+	return f.Close()
+}
+
+// writeCSVReport writes the report rows as CSV with a header line.
+func writeCSVReport(f *os.File, r report) error {
+	w := csv.NewWriter(f)
+	if err := w.Write(reportCSVHeader); err != nil {
+		return err
+	}
+	for _, e := range r.Files {
+		if err := w.Write([]string{
+			e.Input,
+			e.Output,
+			strconv.Itoa(e.OriginalWidth),
+			strconv.Itoa(e.OriginalHeight),
+			strconv.Itoa(e.Width),
+			strconv.Itoa(e.Height),
+			strconv.FormatInt(e.InputBytes, 10),
+			strconv.FormatInt(e.OutputBytes, 10),
+			strconv.FormatFloat(e.DurationMS, 'f', 3, 64),
+			e.Error,
+			e.Skipped,
+			e.Warning,
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,44 @@
+package resize
+
+import "errors"
+
+/*
+ErrWithinBounds is returned instead of a result when the NoUpscale,
+OnlyEnlarge or OnlyShrinkLargerThan option leaves an image (or, with Sizes,
+every variant of it) alone. Nothing is written in that case.
+*/
+var ErrWithinBounds = errors.New("already within bounds")
+
+/*
+withinBounds reports whether the guard options leave an image of the given
+size alone, because it is not larger than OnlyShrinkLargerThan, would have to
+be enlarged despite NoUpscale, or would not be enlarged despite OnlyEnlarge.
+*/
+func (r *Resizer) withinBounds(width, height int) bool {
+	if limit := r.opts.OnlyShrinkLargerThan; limit.Width > 0 || limit.Height > 0 {
+		larger := limit.Width > 0 && width > limit.Width ||
+			limit.Height > 0 && height > limit.Height
+		if !larger {
+			return true
+		}
+	}
+
+	scale := r.contentScale(width, height)
+	return r.opts.NoUpscale && scale > 1 || r.opts.OnlyEnlarge && scale <= 1
+}
+
+/*
+contentScale returns the factor by which the image content is scaled: the
+smaller axis ratio for fit and pad, which keep the whole image inside the box,
+and the larger one otherwise.
+*/
+func (r *Resizer) contentScale(width, height int) float64 {
+	targetWidth, targetHeight := r.TargetSize(width, height)
+	sx := float64(targetWidth) / float64(width)
+	sy := float64(targetHeight) / float64(height)
+	if r.opts.Width > 0 && r.opts.Height > 0 &&
+		(r.opts.Mode == ModeFit || r.opts.Mode == ModePad) {
+		return min(sx, sy)
+	}
+	return max(sx, sy)
+}
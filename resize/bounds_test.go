@@ -0,0 +1,108 @@
+package resize
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithinBounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		width  int
+		height int
+		want   bool
+	}{
+		{"no guards", Options{Width: 800}, 300, 300, false},
+		{"no-upscale small image", Options{Width: 800, NoUpscale: true}, 300, 300, true},
+		{"no-upscale large image", Options{Width: 800, NoUpscale: true}, 1600, 1200, false},
+		{"no-upscale same size", Options{Width: 800, NoUpscale: true}, 800, 600, false},
+		{"no-upscale fit inside box", Options{Width: 400, Height: 400, Mode: ModeFit, NoUpscale: true}, 300, 200, true},
+		{"no-upscale fit one side larger", Options{Width: 400, Height: 400, Mode: ModeFit, NoUpscale: true}, 600, 200, false},
+		{"no-upscale fill needs enlarging", Options{Width: 400, Height: 400, Mode: ModeFill, NoUpscale: true}, 600, 200, true},
+		{"only-enlarge small image", Options{Width: 800, OnlyEnlarge: true}, 300, 300, false},
+		{"only-enlarge large image", Options{Width: 800, OnlyEnlarge: true}, 1600, 1200, true},
+		{"only-enlarge same size", Options{Width: 800, OnlyEnlarge: true}, 800, 600, true},
+		{"shrink limit not exceeded", Options{Width: 800, OnlyShrinkLargerThan: Size{Width: 2000}}, 1600, 1200, true},
+		{"shrink limit exceeded", Options{Width: 800, OnlyShrinkLargerThan: Size{Width: 2000}}, 2400, 1200, false},
+		{"shrink limit height", Options{Width: 800, OnlyShrinkLargerThan: Size{Height: 1000}}, 1600, 1200, false},
+		{"shrink limit both within", Options{Width: 800, OnlyShrinkLargerThan: Size{Width: 2000, Height: 2000}}, 1600, 1200, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(tt.opts)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if got := r.withinBounds(tt.width, tt.height); got != tt.want {
+				t.Errorf("withinBounds(%d, %d) = %v, want %v", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsConflictingGuards(t *testing.T) {
+	for _, opts := range []Options{
+		{Width: 100, NoUpscale: true, OnlyEnlarge: true},
+		{Width: 100, OnlyEnlarge: true, OnlyShrinkLargerThan: Size{Width: 50}},
+		{Width: 100, OnlyShrinkLargerThan: Size{Width: -1}},
+	} {
+		if _, err := New(opts); err == nil {
+			t.Errorf("New(%+v) expected an error", opts)
+		}
+	}
+}
+
+func TestResizeFileWithinBounds(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "icon.png")
+	writeTestPNG(t, input, 300, 200)
+
+	r, err := New(Options{Width: 800, NoUpscale: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := r.ResizeFile(context.Background(), input, ""); !errors.Is(err, ErrWithinBounds) {
+		t.Errorf("ResizeFile() error = %v, want ErrWithinBounds", err)
+	}
+	if _, err := r.Plan(input); !errors.Is(err, ErrWithinBounds) {
+		t.Errorf("Plan() error = %v, want ErrWithinBounds", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected nothing to be written, found %d files", len(entries))
+	}
+}
+
+func TestResizeFileVariantsNoUpscale(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo.png")
+	writeTestPNG(t, input, 700, 350)
+
+	r, err := New(Options{
+		Sizes:     []Size{{Width: 320}, {Width: 1280}, {Width: 640}},
+		NoUpscale: true,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	results, err := r.ResizeFileVariants(context.Background(), input)
+	if err != nil {
+		t.Fatalf("ResizeFileVariants() error = %v", err)
+	}
+	if len(results) != 2 || results[0].Width != 320 || results[1].Width != 640 {
+		t.Fatalf("Expected the 320 and 640 variants in order, got %d results", len(results))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "photo_1280x640.png")); !os.IsNotExist(err) {
+		t.Errorf("The 1280 variant must not be written, stat error = %v", err)
+	}
+
+	planned, err := r.Plan(input)
+	if err != nil || len(planned) != 2 {
+		t.Errorf("Plan() = %d results (err %v), want 2", len(planned), err)
+	}
+}
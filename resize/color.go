@@ -0,0 +1,52 @@
+package resize
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// white is the fallback background used when flattening transparency.
+var white = color.NRGBA{255, 255, 255, 255}
+
+// namedColors are the color names accepted by ParseColor besides hex values.
+var namedColors = map[string]color.NRGBA{
+	"transparent": {0, 0, 0, 0},
+	"white":       white,
+	"black":       {0, 0, 0, 255},
+}
+
+/*
+ParseColor parses a background color given as "transparent", "white",
+"black" or a hex value in #rgb, #rrggbb or #rrggbbaa form (the leading # is
+optional).
+*/
+func ParseColor(s string) (color.NRGBA, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	if c, ok := namedColors[v]; ok {
+		return c, nil
+	}
+
+	hex := strings.TrimPrefix(v, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q (use #rrggbb, #rrggbbaa or transparent)", s)
+	}
+
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q (use #rrggbb, #rrggbbaa or transparent)", s)
+	}
+	return color.NRGBA{
+		R: uint8(n >> 24), // #nosec G115 -- each channel is masked to 8 bits by the shift
+		G: uint8(n >> 16), // #nosec G115
+		B: uint8(n >> 8),  // #nosec G115
+		A: uint8(n),       // #nosec G115
+	}, nil
+}
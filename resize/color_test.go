@@ -0,0 +1,34 @@
+package resize
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected color.NRGBA
+		wantErr  bool
+	}{
+		{"transparent", color.NRGBA{}, false},
+		{"White", color.NRGBA{255, 255, 255, 255}, false},
+		{"#ff8000", color.NRGBA{255, 128, 0, 255}, false},
+		{"00ff0080", color.NRGBA{0, 255, 0, 128}, false},
+		{"#abc", color.NRGBA{0xaa, 0xbb, 0xcc, 255}, false},
+		{"#12345", color.NRGBA{}, true},
+		{"#gggggg", color.NRGBA{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseColor(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColor(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseColor(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package resize
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// EXIF tags and field types touched when carrying metadata over.
+const (
+	tagOrientation     = 0x0112
+	tagArtist          = 0x013b
+	tagCopyright       = 0x8298
+	tagExifIFD         = 0x8769
+	tagPixelXDimension = 0xa002
+	tagPixelYDimension = 0xa003
+
+	typeASCII = 2
+	typeShort = 3
+	typeLong  = 4
+)
+
+// tiffEntry is a single 12-byte IFD entry located at offset pos.
+type tiffEntry struct {
+	pos   int
+	tag   uint16
+	typ   uint16
+	count uint32
+}
+
+// tiffData is the TIFF structure EXIF data is stored in.
+type tiffData struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// parseTIFF checks the TIFF header of EXIF data and detects its byte order.
+func parseTIFF(data []byte) (*tiffData, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, false
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, false
+	}
+	return &tiffData{data: data, order: order}, true
+}
+
+// ifd0 returns the offset of the first image file directory.
+func (t *tiffData) ifd0() uint32 {
+	return t.order.Uint32(t.data[4:])
+}
+
+// entries returns the entries of the IFD at offset, skipping anything out of bounds.
+func (t *tiffData) entries(offset uint32) []tiffEntry {
+	start := int(offset)
+	if offset == 0 || start+2 > len(t.data) {
+		return nil
+	}
+	n := int(t.order.Uint16(t.data[start:]))
+	entries := make([]tiffEntry, 0, n)
+	for i := range n {
+		pos := start + 2 + 12*i
+		if pos+12 > len(t.data) {
+			break
+		}
+		entries = append(entries, tiffEntry{
+			pos:   pos,
+			tag:   t.order.Uint16(t.data[pos:]),
+			typ:   t.order.Uint16(t.data[pos+2:]),
+			count: t.order.Uint32(t.data[pos+4:]),
+		})
+	}
+	return entries
+}
+
+// value returns the raw value bytes of e, inline or at its offset.
+func (t *tiffData) value(e tiffEntry, size int) []byte {
+	n := int(e.count) * size
+	if n <= 4 {
+		return t.data[e.pos+8 : e.pos+8+n]
+	}
+	off := int(t.order.Uint32(t.data[e.pos+8:]))
+	if off < 0 || off+n > len(t.data) {
+		return nil
+	}
+	return t.data[off : off+n]
+}
+
+// setNumber overwrites a single SHORT or LONG value in place.
+func (t *tiffData) setNumber(e tiffEntry, v int) {
+	if e.count != 1 {
+		return
+	}
+	switch e.typ {
+	case typeShort:
+		if v <= 0xffff {
+			t.order.PutUint16(t.data[e.pos+8:], uint16(v)) // #nosec G115 -- bounded above
+		}
+	case typeLong:
+		t.order.PutUint32(t.data[e.pos+8:], uint32(v)) // #nosec G115 -- image sizes are positive
+	}
+}
+
+// exifOrientation returns the orientation tag of EXIF data (1-8), or 1 if it has none.
+func exifOrientation(exif []byte) int {
+	t, ok := parseTIFF(exif)
+	if !ok {
+		return 1
+	}
+	for _, e := range t.entries(t.ifd0()) {
+		if e.tag == tagOrientation && e.typ == typeShort && e.count == 1 {
+			if v := int(t.order.Uint16(t.data[e.pos+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+		}
+	}
+	return 1
+}
+
+/*
+fixupEXIF returns a copy of the EXIF data describing the resized image: the
+pixel-dimension tags are set to the new size and, when the pixels were
+already rotated upright on decode, the orientation tag is reset to normal.
+*/
+func fixupEXIF(exif []byte, oriented bool, width, height int) []byte {
+	t, ok := parseTIFF(bytes.Clone(exif))
+	if !ok {
+		return nil
+	}
+
+	var exifIFD uint32
+	for _, e := range t.entries(t.ifd0()) {
+		switch e.tag {
+		case tagOrientation:
+			if oriented {
+				t.setNumber(e, 1)
+			}
+		case tagExifIFD:
+			exifIFD = t.order.Uint32(t.data[e.pos+8:])
+		}
+	}
+
+	for _, e := range t.entries(exifIFD) {
+		switch e.tag {
+		case tagPixelXDimension:
+			t.setNumber(e, width)
+		case tagPixelYDimension:
+			t.setNumber(e, height)
+		}
+	}
+
+	return t.data
+}
+
+/*
+copyrightEXIF builds a minimal EXIF block that contains only the Artist and
+Copyright tags of the source, or returns nil if it has neither.
+*/
+func copyrightEXIF(exif []byte) []byte {
+	t, ok := parseTIFF(exif)
+	if !ok {
+		return nil
+	}
+
+	type field struct {
+		tag   uint16
+		value []byte
+	}
+	var fields []field
+	for _, e := range t.entries(t.ifd0()) {
+		if (e.tag == tagArtist || e.tag == tagCopyright) && e.typ == typeASCII {
+			if v := t.value(e, 1); v != nil {
+				fields = append(fields, field{e.tag, v})
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// Big-endian header, one IFD at offset 8, then the out-of-line values
+	out := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	out = binary.BigEndian.AppendUint16(out, uint16(len(fields))) // #nosec G115
+	dataOffset := 8 + 2 + 12*len(fields) + 4
+	var values []byte
+	for _, f := range fields {
+		out = binary.BigEndian.AppendUint16(out, f.tag)
+		out = binary.BigEndian.AppendUint16(out, typeASCII)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(f.value))) // #nosec G115
+		if len(f.value) <= 4 {
+			inline := make([]byte, 4)
+			copy(inline, f.value)
+			out = append(out, inline...)
+			continue
+		}
+		out = binary.BigEndian.AppendUint32(out, uint32(dataOffset+len(values))) // #nosec G115
+		values = append(values, f.value...)
+		if len(values)%2 == 1 {
+			values = append(values, 0) // keep offsets word aligned
+		}
+	}
+	out = append(out, 0, 0, 0, 0) // no next IFD
+	return append(out, values...)
+}
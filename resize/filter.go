@@ -0,0 +1,70 @@
+package resize
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Filter names the resampling filter used to scale images.
+type Filter string
+
+// Supported resampling filters, from fastest to highest quality.
+const (
+	FilterNearest    Filter = "nearest"
+	FilterBox        Filter = "box"
+	FilterLinear     Filter = "linear"
+	FilterHermite    Filter = "hermite"
+	FilterMitchell   Filter = "mitchell"
+	FilterCatmullRom Filter = "catmull-rom"
+	FilterBSpline    Filter = "bspline"
+	FilterGaussian   Filter = "gaussian"
+	FilterBartlett   Filter = "bartlett"
+	FilterHann       Filter = "hann"
+	FilterHamming    Filter = "hamming"
+	FilterBlackman   Filter = "blackman"
+	FilterWelch      Filter = "welch"
+	FilterCosine     Filter = "cosine"
+	FilterLanczos    Filter = "lanczos"
+)
+
+// filters maps each Filter to the imaging resampling filter it selects.
+var filters = map[Filter]imaging.ResampleFilter{
+	FilterNearest:    imaging.NearestNeighbor,
+	FilterBox:        imaging.Box,
+	FilterLinear:     imaging.Linear,
+	FilterHermite:    imaging.Hermite,
+	FilterMitchell:   imaging.MitchellNetravali,
+	FilterCatmullRom: imaging.CatmullRom,
+	FilterBSpline:    imaging.BSpline,
+	FilterGaussian:   imaging.Gaussian,
+	FilterBartlett:   imaging.Bartlett,
+	FilterHann:       imaging.Hann,
+	FilterHamming:    imaging.Hamming,
+	FilterBlackman:   imaging.Blackman,
+	FilterWelch:      imaging.Welch,
+	FilterCosine:     imaging.Cosine,
+	FilterLanczos:    imaging.Lanczos,
+}
+
+// FilterNames lists the accepted filter names for help and error messages.
+const FilterNames = "nearest, box, linear, hermite, mitchell, catmull-rom, bspline, " +
+	"gaussian, bartlett, hann, hamming, blackman, welch, cosine, lanczos"
+
+// ParseFilter converts a case-insensitive filter name into a Filter.
+func ParseFilter(s string) (Filter, error) {
+	f := Filter(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := filters[f]; !ok {
+		return "", fmt.Errorf("invalid filter %q (valid: %s)", s, FilterNames)
+	}
+	return f, nil
+}
+
+// resampleFilter returns the imaging filter for f, defaulting to Lanczos.
+func (f Filter) resampleFilter() imaging.ResampleFilter {
+	if filter, ok := filters[f]; ok {
+		return filter
+	}
+	return imaging.Lanczos
+}
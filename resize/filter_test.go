@@ -0,0 +1,66 @@
+package resize
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Filter
+		wantErr  bool
+	}{
+		{"lanczos", FilterLanczos, false},
+		{"Nearest", FilterNearest, false},
+		{"catmull-rom", FilterCatmullRom, false},
+		{"bicubic", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseFilter(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFilter(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseFilter(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFilterDefaultsToLanczos(t *testing.T) {
+	r, err := New(Options{Width: 10})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if got := r.Options().Filter; got != FilterLanczos {
+		t.Errorf("Filter = %q, want %q", got, FilterLanczos)
+	}
+}
+
+func TestNearestFilterKeepsHardEdges(t *testing.T) {
+	// Upscaling a two-color image with nearest-neighbor must not introduce
+	// blended colors, unlike the default Lanczos filter.
+	src := newTestImage(2, 1)
+	r, err := New(Options{Width: 8, Height: 4, Filter: FilterNearest})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	result := r.newResult(src)
+	resized := r.scale(src, result)
+	allowed := map[color.NRGBA]bool{
+		color.NRGBAModel.Convert(src.At(0, 0)).(color.NRGBA): true,
+		color.NRGBAModel.Convert(src.At(1, 0)).(color.NRGBA): true,
+	}
+	for y := range 4 {
+		for x := range 8 {
+			c := color.NRGBAModel.Convert(resized.At(x, y)).(color.NRGBA)
+			if !allowed[c] {
+				t.Fatalf("pixel (%d,%d) = %v is not one of the source colors", x, y, c)
+			}
+		}
+	}
+}
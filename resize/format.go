@@ -0,0 +1,136 @@
+package resize
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/gen2brain/webp"
+)
+
+// Format is an output image format.
+type Format string
+
+// Supported image formats.
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatGIF  Format = "gif"
+	FormatTIFF Format = "tiff"
+	FormatBMP  Format = "bmp"
+	FormatWebP Format = "webp"
+)
+
+// formatExts maps lower-case file extensions (without the dot) to formats.
+var formatExts = map[string]Format{
+	"jpg":  FormatJPEG,
+	"jpeg": FormatJPEG,
+	"png":  FormatPNG,
+	"gif":  FormatGIF,
+	"tif":  FormatTIFF,
+	"tiff": FormatTIFF,
+	"bmp":  FormatBMP,
+	"webp": FormatWebP,
+}
+
+// imagingFormats maps each format to the imaging encoder that writes it.
+var imagingFormats = map[Format]imaging.Format{
+	FormatJPEG: imaging.JPEG,
+	FormatPNG:  imaging.PNG,
+	FormatGIF:  imaging.GIF,
+	FormatTIFF: imaging.TIFF,
+	FormatBMP:  imaging.BMP,
+}
+
+/*
+ParseFormat converts a case-insensitive format name or file extension such as
+"jpg", ".JPEG" or "tif" into a Format.
+*/
+func ParseFormat(s string) (Format, error) {
+	if f, ok := formatExts[strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "."))]; ok {
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported image format: %s", s)
+}
+
+// FormatFromFilename returns the format implied by the extension of filename.
+func FormatFromFilename(filename string) (Format, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if f, ok := formatExts[strings.TrimPrefix(ext, ".")]; ok {
+		return f, nil
+	}
+	return "", fmt.Errorf("unsupported image format: %s", ext)
+}
+
+// Ext returns the canonical file extension for the format, including the dot.
+func (f Format) Ext() string {
+	switch f {
+	case FormatJPEG:
+		return ".jpg"
+	case FormatTIFF:
+		return ".tiff"
+	case FormatPNG, FormatGIF, FormatBMP, FormatWebP:
+	}
+	return "." + string(f)
+}
+
+// matches reports whether ext (e.g. ".JPEG") is an extension of the format.
+func (f Format) matches(ext string) bool {
+	return formatExts[strings.ToLower(strings.TrimPrefix(ext, "."))] == f
+}
+
+// supportsAlpha reports whether the format can store transparent pixels.
+func (f Format) supportsAlpha() bool {
+	switch f {
+	case FormatPNG, FormatGIF, FormatTIFF, FormatWebP:
+		return true
+	case FormatJPEG, FormatBMP:
+	}
+	return false
+}
+
+/*
+encodeImage writes img to w in format f. WebP is encoded lossily at the
+Quality option unless Lossless is set; the other formats use imaging.
+*/
+func (r *Resizer) encodeImage(w io.Writer, img image.Image, f Format) error {
+	if f == FormatWebP {
+		return webp.Encode(w, img, webp.Options{
+			Quality:  r.opts.Quality,
+			Lossless: r.opts.Lossless,
+			Method:   webp.DefaultMethod,
+		})
+	}
+
+	format, ok := imagingFormats[f]
+	if !ok {
+		return fmt.Errorf("unsupported image format: %s", f)
+	}
+	return imaging.Encode(w, img, format, imaging.JPEGQuality(r.opts.Quality))
+}
+
+/*
+flatten composites img onto an opaque background for formats that cannot
+store transparency. The Background option is used when it is opaque, white
+otherwise, so transparent areas do not turn black.
+*/
+func (r *Resizer) flatten(img image.Image, f Format) image.Image {
+	if f.supportsAlpha() {
+		return img
+	}
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+
+	bg := r.opts.Background
+	if bg.A != 0xff {
+		bg = white
+	}
+	canvas := imaging.New(img.Bounds().Dx(), img.Bounds().Dy(), bg)
+	draw.Draw(canvas, canvas.Bounds(), img, img.Bounds().Min, draw.Over)
+	return canvas
+}
@@ -0,0 +1,238 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/bmp"
+	xwebp "golang.org/x/image/webp"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Format
+		wantErr  bool
+	}{
+		{"jpg", FormatJPEG, false},
+		{".JPEG", FormatJPEG, false},
+		{"png", FormatPNG, false},
+		{"tif", FormatTIFF, false},
+		{"bmp", FormatBMP, false},
+		{"WebP", FormatWebP, false},
+		{"psd", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseFormat(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormat(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseFormat(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestOutputPathWithFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     Options
+		input    string
+		expected string
+	}{
+		{"converted extension", Options{Format: FormatJPEG}, "/a/scan.bmp", "/a/scan_10x10.jpg"},
+		{"matching extension kept", Options{Format: FormatJPEG}, "/a/photo.JPEG", "/a/photo_10x10.JPEG"},
+		{"overwrite same format", Options{Format: FormatPNG, Overwrite: true}, "/a/x.png", "/a/x.png"},
+		{"overwrite converted", Options{Format: FormatPNG, Overwrite: true}, "/a/x.tif", "/a/x.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.OutputPath(tt.input, 10, 10); got != tt.expected {
+				t.Errorf("OutputPath() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResizeFileConvertsFormat(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Half-transparent source: converting to JPEG must flatten against the background
+	src := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	for y := range 20 {
+		for x := range 20 {
+			if x < 10 {
+				src.Set(x, y, color.NRGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	pngPath := filepath.Join(tempDir, "logo.png")
+	bmpPath := filepath.Join(tempDir, "scan.bmp")
+	for path, encode := range map[string]func(*os.File) error{
+		pngPath: func(f *os.File) error { return png.Encode(f, src) },
+		bmpPath: func(f *os.File) error { return bmp.Encode(f, newTestImage(20, 20)) },
+	} {
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+		if err := encode(f); err != nil {
+			t.Fatalf("Failed to encode %s: %v", path, err)
+		}
+		f.Close()
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		background color.NRGBA
+		wantPath   string
+		wantCorner color.NRGBA
+	}{
+		{"png to jpeg on white", pngPath, color.NRGBA{}, "logo_10x10.jpg", white},
+		{"png to jpeg on red", pngPath, color.NRGBA{255, 0, 0, 255}, "logo_10x10.jpg", color.NRGBA{255, 0, 0, 255}},
+		{"bmp to jpeg", bmpPath, color.NRGBA{}, "scan_10x10.jpg", color.NRGBA{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outDir := filepath.Join(tempDir, tt.name)
+			r, err := New(Options{
+				Width:      10,
+				Format:     FormatJPEG,
+				OutputDir:  outDir,
+				Background: tt.background,
+			})
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+
+			result, err := r.ResizeFile(context.Background(), tt.input, "")
+			if err != nil {
+				t.Fatalf("ResizeFile() returned error: %v", err)
+			}
+			if result.OutputPath != filepath.Join(outDir, tt.wantPath) {
+				t.Errorf("OutputPath = %q, want %q", result.OutputPath, tt.wantPath)
+			}
+			if result.Format != FormatJPEG {
+				t.Errorf("Format = %q, want %q", result.Format, FormatJPEG)
+			}
+
+			f, err := os.Open(result.OutputPath)
+			if err != nil {
+				t.Fatalf("Failed to open output: %v", err)
+			}
+			defer f.Close()
+			img, format, err := image.Decode(f)
+			if err != nil || format != "jpeg" {
+				t.Fatalf("output decode = %q, %v; want jpeg", format, err)
+			}
+
+			if tt.wantCorner == (color.NRGBA{}) {
+				return
+			}
+			// The right half was transparent; JPEG is lossy so allow some tolerance
+			got := color.NRGBAModel.Convert(img.At(8, 5)).(color.NRGBA)
+			if diff(got.R, tt.wantCorner.R) > 24 || diff(got.G, tt.wantCorner.G) > 24 ||
+				diff(got.B, tt.wantCorner.B) > 24 {
+				t.Errorf("flattened pixel = %v, want about %v", got, tt.wantCorner)
+			}
+		})
+	}
+}
+
+// diff returns the absolute difference of two channel values.
+func diff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+func TestResizeWebP(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, newTestImage(40, 20)); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		lossless bool
+	}{
+		{"lossy", Options{Width: 20, Format: FormatWebP, Quality: 80}, false},
+		{"lossless", Options{Width: 20, Format: FormatWebP, Lossless: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(tt.opts)
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+
+			var out bytes.Buffer
+			result, err := r.Resize(context.Background(), bytes.NewReader(src.Bytes()), &out)
+			if err != nil {
+				t.Fatalf("Resize() returned error: %v", err)
+			}
+			if result.Format != FormatWebP {
+				t.Errorf("Format = %q, want %q", result.Format, FormatWebP)
+			}
+
+			encoded := out.Bytes()
+			img, err := xwebp.Decode(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("output is not a valid WebP: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 10 {
+				t.Errorf("size = %dx%d, want 20x10", b.Dx(), b.Dy())
+			}
+			// Lossless WebP uses a VP8L chunk, lossy WebP a VP8 chunk
+			if got := bytes.Contains(encoded[:16], []byte("VP8L")); got != tt.lossless {
+				t.Errorf("VP8L chunk present = %v, want %v", got, tt.lossless)
+			}
+		})
+	}
+}
+
+func TestResizeFileWebPInput(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Produce a WebP source with the resizer itself, then read it back
+	encoder, err := New(Options{Width: 40, Format: FormatWebP, Lossless: true})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	pngPath := filepath.Join(tempDir, "src.png")
+	writeTestPNG(t, pngPath, 40, 20)
+	webpPath := filepath.Join(tempDir, "asset.webp")
+	if _, err := encoder.ResizeFile(context.Background(), pngPath, webpPath); err != nil {
+		t.Fatalf("ResizeFile() to WebP returned error: %v", err)
+	}
+
+	r, err := New(Options{Width: 10})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	result, err := r.ResizeFile(context.Background(), webpPath, "")
+	if err != nil {
+		t.Fatalf("ResizeFile() from WebP returned error: %v", err)
+	}
+	if want := filepath.Join(tempDir, "asset_10x5.webp"); result.OutputPath != want {
+		t.Errorf("OutputPath = %q, want %q", result.OutputPath, want)
+	}
+	if w, h := decodeSize(t, result.OutputPath); w != 10 || h != 5 {
+		t.Errorf("output size = %dx%d, want 10x5", w, h)
+	}
+}
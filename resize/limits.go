@@ -0,0 +1,64 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+)
+
+/*
+ErrLimitExceeded is wrapped by the errors returned for inputs rejected by the
+MaxPixels or MaxInputBytes option. Such images are never decoded.
+*/
+var ErrLimitExceeded = errors.New("safety limit exceeded")
+
+/*
+bytesPerPixel estimates the memory a pixel takes while an image is resized:
+the decoded 32-bit source plus the scaled copy and encoder buffers.
+*/
+const bytesPerPixel = 8
+
+// checkInputSize rejects inputs larger than MaxInputBytes.
+func (o Options) checkInputSize(size int64) error {
+	if o.MaxInputBytes > 0 && size > o.MaxInputBytes {
+		return fmt.Errorf("%w: input is %d bytes (limit %d)", ErrLimitExceeded, size, o.MaxInputBytes)
+	}
+	return nil
+}
+
+// checkPixels rejects images whose header declares more than MaxPixels pixels.
+func (o Options) checkPixels(width, height int) error {
+	if pixels := int64(width) * int64(height); o.MaxPixels > 0 && pixels > o.MaxPixels {
+		return fmt.Errorf("%w: image is %dx%d, %d pixels (limit %d)",
+			ErrLimitExceeded, width, height, pixels, o.MaxPixels)
+	}
+	return nil
+}
+
+/*
+admit reads the image header from data, checks it against MaxPixels and
+reserves the memory needed to decode it from the MemoryBudget, waiting until
+enough is free. The returned function gives the memory back; it must be
+called once the image is no longer needed.
+*/
+func (r *Resizer) admit(ctx context.Context, data []byte) (func(), error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err := r.opts.checkPixels(cfg.Width, cfg.Height); err != nil {
+		return nil, err
+	}
+	if r.budget == nil {
+		return func() {}, nil
+	}
+
+	// An image larger than the whole budget waits to run on its own instead of forever
+	cost := min(int64(cfg.Width)*int64(cfg.Height)*bytesPerPixel, r.opts.MemoryBudget)
+	if err := r.budget.Acquire(ctx, cost); err != nil {
+		return nil, err
+	}
+	return func() { r.budget.Release(cost) }, nil
+}
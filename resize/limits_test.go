@@ -0,0 +1,147 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Helper function to write a PNG whose header declares a huge size it does not contain
+func writeBombPNG(t *testing.T, path string, width, height uint32) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, newTestImage(1, 1)); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	data := buf.Bytes()
+	// The IHDR chunk follows the 8-byte signature: length, type, width, height, ...
+	ihdr := data[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:4], width)
+	binary.BigEndian.PutUint32(ihdr[4:8], height)
+	binary.BigEndian.PutUint32(data[8+8+13:], crc32.ChecksumIEEE(data[8+4:8+8+13]))
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("Failed to write test image: %v", err)
+	}
+}
+
+func TestResizeFileLimits(t *testing.T) {
+	tempDir := t.TempDir()
+	bombPath := filepath.Join(tempDir, "bomb.png")
+	writeBombPNG(t, bombPath, 50000, 50000)
+	photoPath := filepath.Join(tempDir, "photo.png")
+	writeTestPNG(t, photoPath, 400, 300)
+	info, err := os.Stat(photoPath)
+	if err != nil {
+		t.Fatalf("Failed to stat test image: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		input   string
+		wantErr bool
+	}{
+		{"bomb rejected by max pixels", Options{Width: 100, MaxPixels: 100_000_000}, bombPath, true},
+		{"pixels within limit", Options{Width: 100, MaxPixels: 400 * 300}, photoPath, false},
+		{"pixels over limit", Options{Width: 100, MaxPixels: 400*300 - 1}, photoPath, true},
+		{"bytes within limit", Options{Width: 100, MaxInputBytes: info.Size()}, photoPath, false},
+		{"bytes over limit", Options{Width: 100, MaxInputBytes: info.Size() - 1}, photoPath, true},
+		{"sizes over limit", Options{Sizes: []Size{{Width: 50}, {Width: 20}}, MaxPixels: 1000}, photoPath, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.OutputDir = t.TempDir()
+			r, err := New(tt.opts)
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+
+			_, err = r.ResizeFileVariants(context.Background(), tt.input)
+			if tt.wantErr != errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("ResizeFileVariants() error = %v, want ErrLimitExceeded: %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("ResizeFileVariants() returned error: %v", err)
+			}
+
+			entries, err := os.ReadDir(tt.opts.OutputDir)
+			if err != nil {
+				t.Fatalf("Failed to read output directory: %v", err)
+			}
+			if tt.wantErr && len(entries) != 0 {
+				t.Errorf("rejected image wrote %d files", len(entries))
+			}
+		})
+	}
+}
+
+func TestResizeMaxInputBytes(t *testing.T) {
+	var in bytes.Buffer
+	if err := png.Encode(&in, newTestImage(40, 30)); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+
+	r, err := New(Options{Width: 20, MaxInputBytes: int64(in.Len() - 1)})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	if _, err := r.Resize(context.Background(), &in, &out); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Resize() error = %v, want ErrLimitExceeded", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Resize() wrote %d bytes for a rejected image", out.Len())
+	}
+}
+
+func TestPlanLimits(t *testing.T) {
+	bombPath := filepath.Join(t.TempDir(), "bomb.png")
+	writeBombPNG(t, bombPath, 50000, 50000)
+
+	r, err := New(Options{Width: 100, MaxPixels: 100_000_000})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if _, err := r.Plan(bombPath); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Plan() error = %v, want ErrLimitExceeded", err)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "photo.png")
+	writeTestPNG(t, inputPath, 400, 300)
+
+	// The image needs more than the whole budget, so it must wait until the budget is free
+	budget := int64(1000)
+	r, err := New(Options{Width: 100, MemoryBudget: budget})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if err := r.budget.Acquire(context.Background(), 1); err != nil {
+		t.Fatalf("Acquire() returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := r.ResizeFile(ctx, inputPath, ""); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ResizeFile() with the budget in use: error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	r.budget.Release(1)
+	if _, err := r.ResizeFile(context.Background(), inputPath, ""); err != nil {
+		t.Fatalf("ResizeFile() returned error: %v", err)
+	}
+	// Everything reserved for the resize has been given back
+	if !r.budget.TryAcquire(budget) {
+		t.Error("memory budget not released after ResizeFile()")
+	}
+}
@@ -0,0 +1,354 @@
+package resize
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// MetadataMode selects which source metadata is carried over to the output.
+type MetadataMode string
+
+// Supported metadata modes.
+const (
+	MetadataStrip     MetadataMode = "strip"          // Drop all metadata (the encoders' default)
+	MetadataKeep      MetadataMode = "keep"           // Copy EXIF, XMP and the ICC color profile
+	MetadataCopyright MetadataMode = "copyright-only" // Keep the ICC profile and EXIF Artist/Copyright only
+)
+
+// ParseMetadataMode converts a case-insensitive metadata mode name into a MetadataMode.
+func ParseMetadataMode(s string) (MetadataMode, error) {
+	m := MetadataMode(strings.ToLower(strings.TrimSpace(s)))
+	switch m {
+	case MetadataStrip, MetadataKeep, MetadataCopyright:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid metadata mode %q (valid: keep, strip, copyright-only)", s)
+}
+
+/*
+metadata holds the format-neutral metadata blocks of an image: the raw TIFF
+structure of the EXIF data, the XMP packet and the ICC color profile. Keeping
+them independent of the container lets metadata move between JPEG and PNG.
+*/
+type metadata struct {
+	exif []byte
+	xmp  []byte
+	icc  []byte
+}
+
+// Segment and chunk signatures used to locate metadata in JPEG and PNG files.
+const (
+	jpegExifHeader = "Exif\x00\x00"
+	jpegXMPHeader  = "http://ns.adobe.com/xap/1.0/\x00"
+	jpegICCHeader  = "ICC_PROFILE\x00"
+	pngSignature   = "\x89PNG\r\n\x1a\n"
+	pngXMPKeyword  = "XML:com.adobe.xmp"
+	pngICCName     = "ICC Profile"
+
+	// jpegMaxSegment is the largest payload a JPEG marker segment can carry.
+	jpegMaxSegment = 0xffff - 2
+	// jpegMaxICCChunk is the ICC payload per APP2 segment after its 14-byte header.
+	jpegMaxICCChunk = jpegMaxSegment - len(jpegICCHeader) - 2
+)
+
+// JPEG markers referenced while walking segments.
+const (
+	markerSOI  = 0xd8
+	markerSOS  = 0xda
+	markerAPP1 = 0xe1
+	markerAPP2 = 0xe2
+)
+
+// readMetadata extracts metadata from an encoded image of the given format.
+func readMetadata(data []byte, format Format) metadata {
+	switch format {
+	case FormatJPEG:
+		return readJPEGMetadata(data)
+	case FormatPNG:
+		return readPNGMetadata(data)
+	default:
+		return metadata{}
+	}
+}
+
+/*
+readJPEGMetadata walks the marker segments in front of the image data and
+collects the EXIF (APP1), XMP (APP1) and ICC profile (APP2, possibly split
+over several segments) blocks.
+*/
+func readJPEGMetadata(data []byte) metadata {
+	var md metadata
+	iccChunks := map[byte][]byte{}
+
+	if len(data) < 4 || data[0] != 0xff || data[1] != markerSOI {
+		return md
+	}
+
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xff {
+			break
+		}
+		marker := data[pos+1]
+		if marker == markerSOS {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		payload := data[pos+4 : end]
+
+		switch {
+		case marker == markerAPP1 && bytes.HasPrefix(payload, []byte(jpegExifHeader)):
+			md.exif = payload[len(jpegExifHeader):]
+		case marker == markerAPP1 && bytes.HasPrefix(payload, []byte(jpegXMPHeader)):
+			md.xmp = payload[len(jpegXMPHeader):]
+		case marker == markerAPP2 && bytes.HasPrefix(payload, []byte(jpegICCHeader)) &&
+			len(payload) > len(jpegICCHeader)+2:
+			seq := payload[len(jpegICCHeader)]
+			iccChunks[seq] = payload[len(jpegICCHeader)+2:]
+		}
+
+		pos = end
+	}
+
+	// ICC chunks are numbered from 1 in the order they must be joined
+	for seq := 1; seq <= len(iccChunks); seq++ {
+		chunk, ok := iccChunks[byte(seq)] // #nosec G115 -- at most 256 distinct keys
+		if !ok {
+			md.icc = nil
+			break
+		}
+		md.icc = append(md.icc, chunk...)
+	}
+
+	return md
+}
+
+/*
+readPNGMetadata collects the eXIf, iCCP (zlib-compressed profile) and
+XMP iTXt chunks of a PNG file.
+*/
+func readPNGMetadata(data []byte) metadata {
+	var md metadata
+	for chunkType, payload := range pngChunks(data) {
+		switch chunkType {
+		case "eXIf":
+			md.exif = payload
+		case "iCCP":
+			// profile name, NUL, compression method, compressed profile
+			i := bytes.IndexByte(payload, 0)
+			if i < 0 || i+2 > len(payload) {
+				continue
+			}
+			if profile, err := inflate(payload[i+2:]); err == nil {
+				md.icc = profile
+			}
+		case "iTXt":
+			// Other text chunks such as a Comment may follow the XMP one
+			if xmp := readPNGXMP(payload); xmp != nil {
+				md.xmp = xmp
+			}
+		}
+	}
+	return md
+}
+
+// readPNGXMP returns the XMP packet of an iTXt chunk, or nil for other keywords.
+func readPNGXMP(payload []byte) []byte {
+	// keyword, NUL, compression flag, compression method,
+	// language tag, NUL, translated keyword, NUL, text
+	keyword, rest, ok := bytes.Cut(payload, []byte{0})
+	if !ok || string(keyword) != pngXMPKeyword || len(rest) < 2 {
+		return nil
+	}
+	compressed := rest[0] == 1
+	rest = rest[2:]
+	for range 2 {
+		if _, rest, ok = bytes.Cut(rest, []byte{0}); !ok {
+			return nil
+		}
+	}
+	if !compressed {
+		return rest
+	}
+	text, err := inflate(rest)
+	if err != nil {
+		return nil
+	}
+	return text
+}
+
+// pngChunks iterates over the type and payload of each chunk in a PNG file.
+func pngChunks(data []byte) func(yield func(string, []byte) bool) {
+	return func(yield func(string, []byte) bool) {
+		if !bytes.HasPrefix(data, []byte(pngSignature)) {
+			return
+		}
+		for pos := len(pngSignature); pos+12 <= len(data); {
+			length := int(binary.BigEndian.Uint32(data[pos:]))
+			end := pos + 12 + length
+			if end > len(data) {
+				return
+			}
+			if !yield(string(data[pos+4:pos+8]), data[pos+8:pos+8+length]) {
+				return
+			}
+			pos = end
+		}
+	}
+}
+
+/*
+prepare adapts source metadata to the output according to the mode: EXIF
+orientation and pixel-dimension tags are updated to describe the resized
+image, and copyright-only reduces EXIF to the Artist and Copyright tags.
+*/
+func (md metadata) prepare(mode MetadataMode, oriented bool, width, height int) metadata {
+	switch mode {
+	case MetadataKeep:
+		if md.exif != nil {
+			md.exif = fixupEXIF(md.exif, oriented, width, height)
+		}
+		return md
+	case MetadataCopyright:
+		return metadata{exif: copyrightEXIF(md.exif), icc: md.icc}
+	case MetadataStrip:
+	}
+	return metadata{}
+}
+
+// empty reports whether there is no metadata to write.
+func (md metadata) empty() bool {
+	return md.exif == nil && md.xmp == nil && md.icc == nil
+}
+
+// writeMetadata inserts metadata into an encoded image of the given format.
+func writeMetadata(data []byte, format Format, md metadata) []byte {
+	if md.empty() {
+		return data
+	}
+	switch format {
+	case FormatJPEG:
+		return writeJPEGMetadata(data, md)
+	case FormatPNG:
+		return writePNGMetadata(data, md)
+	default:
+		return data
+	}
+}
+
+/*
+writeJPEGMetadata inserts EXIF and XMP APP1 segments and ICC APP2 segments
+right after the SOI marker. Blocks too large for a single segment (other than
+the ICC profile, which may be split) are dropped.
+*/
+func writeJPEGMetadata(data []byte, md metadata) []byte {
+	if len(data) < 2 {
+		return data
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data[:2])
+
+	writeSegment := func(marker byte, parts ...[]byte) {
+		n := 0
+		for _, p := range parts {
+			n += len(p)
+		}
+		if n > jpegMaxSegment {
+			return
+		}
+		buf.Write([]byte{0xff, marker})
+		_ = binary.Write(&buf, binary.BigEndian, uint16(n+2)) // #nosec G115 -- bounded above
+		for _, p := range parts {
+			buf.Write(p)
+		}
+	}
+
+	if md.exif != nil {
+		writeSegment(markerAPP1, []byte(jpegExifHeader), md.exif)
+	}
+	if md.xmp != nil {
+		writeSegment(markerAPP1, []byte(jpegXMPHeader), md.xmp)
+	}
+	if md.icc != nil {
+		count := (len(md.icc) + jpegMaxICCChunk - 1) / jpegMaxICCChunk
+		if count <= 255 {
+			for i := range count {
+				chunk := md.icc[i*jpegMaxICCChunk : min((i+1)*jpegMaxICCChunk, len(md.icc))]
+				seq := []byte{byte(i + 1), byte(count)} // #nosec G115 -- count <= 255
+				writeSegment(markerAPP2, []byte(jpegICCHeader), seq, chunk)
+			}
+		}
+	}
+
+	buf.Write(data[2:])
+	return buf.Bytes()
+}
+
+/*
+writePNGMetadata inserts iCCP, eXIf and XMP iTXt chunks right after the IHDR
+chunk, which places them before PLTE and IDAT as the PNG specification
+requires.
+*/
+func writePNGMetadata(data []byte, md metadata) []byte {
+	// Signature plus the 13-byte IHDR chunk and its length, type and CRC
+	ihdrEnd := len(pngSignature) + 12 + 13
+	if len(data) < ihdrEnd || !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return data
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data[:ihdrEnd])
+
+	if md.icc != nil {
+		var payload bytes.Buffer
+		payload.WriteString(pngICCName)
+		payload.Write([]byte{0, 0}) // NUL separator, zlib compression
+		zw := zlib.NewWriter(&payload)
+		_, _ = zw.Write(md.icc)
+		_ = zw.Close()
+		writePNGChunk(&buf, "iCCP", payload.Bytes())
+	}
+	if md.exif != nil {
+		writePNGChunk(&buf, "eXIf", md.exif)
+	}
+	if md.xmp != nil {
+		var payload bytes.Buffer
+		payload.WriteString(pngXMPKeyword)
+		payload.Write([]byte{0, 0, 0, 0, 0}) // uncompressed, no language or translation
+		payload.Write(md.xmp)
+		writePNGChunk(&buf, "iTXt", payload.Bytes())
+	}
+
+	buf.Write(data[ihdrEnd:])
+	return buf.Bytes()
+}
+
+// writePNGChunk appends a single PNG chunk with its length and CRC.
+func writePNGChunk(w *bytes.Buffer, chunkType string, payload []byte) {
+	_ = binary.Write(w, binary.BigEndian, uint32(len(payload))) // #nosec G115
+	crc := crc32.NewIEEE()
+	_, _ = io.WriteString(crc, chunkType)
+	_, _ = crc.Write(payload)
+	w.WriteString(chunkType)
+	w.Write(payload)
+	_ = binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// inflate decompresses a zlib stream.
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,235 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Helper function to build EXIF data with orientation, copyright and pixel dimensions
+func testEXIF(orientation uint16, copyright string, width, height uint32) []byte {
+	be := binary.BigEndian
+	value := append([]byte(copyright), 0)
+
+	out := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	// IFD0 at 8: orientation, copyright (out of line at 80), Exif IFD pointer (50)
+	out = be.AppendUint16(out, 3)
+	out = append(out, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01)
+	out = be.AppendUint16(out, orientation)
+	out = append(out, 0x00, 0x00)
+	out = append(out, 0x82, 0x98, 0x00, 0x02)
+	out = be.AppendUint32(out, uint32(len(value))) // #nosec G115
+	out = be.AppendUint32(out, 80)
+	out = append(out, 0x87, 0x69, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01)
+	out = be.AppendUint32(out, 50)
+	out = be.AppendUint32(out, 0)
+	// Exif IFD at 50: PixelXDimension, PixelYDimension
+	out = be.AppendUint16(out, 2)
+	out = append(out, 0xa0, 0x02, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01)
+	out = be.AppendUint32(out, width)
+	out = append(out, 0xa0, 0x03, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01)
+	out = be.AppendUint32(out, height)
+	out = be.AppendUint32(out, 0)
+	return append(out, value...)
+}
+
+// Helper function to read a numeric or ASCII EXIF tag from IFD0 or the Exif IFD
+func exifTag(t *testing.T, exif []byte, tag uint16) (uint32, string) {
+	t.Helper()
+	td, ok := parseTIFF(exif)
+	if !ok {
+		t.Fatalf("invalid EXIF data")
+	}
+	var exifIFD uint32
+	ifd0 := td.entries(td.ifd0())
+	for _, e := range ifd0 {
+		if e.tag == tagExifIFD {
+			exifIFD = td.order.Uint32(td.data[e.pos+8:])
+		}
+	}
+	for _, e := range append(ifd0, td.entries(exifIFD)...) {
+		if e.tag != tag {
+			continue
+		}
+		switch e.typ {
+		case typeShort:
+			return uint32(td.order.Uint16(td.data[e.pos+8:])), ""
+		case typeLong:
+			return td.order.Uint32(td.data[e.pos+8:]), ""
+		case typeASCII:
+			return 0, string(bytes.TrimRight(td.value(e, 1), "\x00"))
+		}
+	}
+	return 0, ""
+}
+
+func TestParseMetadataMode(t *testing.T) {
+	for _, valid := range []string{"keep", "STRIP", "copyright-only"} {
+		if _, err := ParseMetadataMode(valid); err != nil {
+			t.Errorf("ParseMetadataMode(%q) returned error: %v", valid, err)
+		}
+	}
+	if _, err := ParseMetadataMode("all"); err == nil {
+		t.Error("ParseMetadataMode(\"all\") expected error, got nil")
+	}
+}
+
+func TestResizeMetadata(t *testing.T) {
+	// A 40x20 JPEG stored sideways (orientation 6) with EXIF, XMP and a
+	// profile large enough to be split over two APP2 segments.
+	icc := bytes.Repeat([]byte("icc-profile-"), 8000)
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"/>`)
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, newTestImage(40, 20), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	src := writeJPEGMetadata(plain.Bytes(), metadata{
+		exif: testEXIF(6, "ACME Corp", 40, 20),
+		xmp:  xmp,
+		icc:  icc,
+	})
+
+	tests := []struct {
+		name        string
+		mode        MetadataMode
+		outputExt   string
+		wantEXIF    bool
+		wantXMP     bool
+		wantICC     bool
+		wantOrient  uint32
+		wantPixelsX uint32
+	}{
+		{"strip", MetadataStrip, ".jpg", false, false, false, 0, 0},
+		{"keep jpeg", MetadataKeep, ".jpg", true, true, true, 1, 10},
+		{"keep converted to png", MetadataKeep, ".png", true, true, true, 1, 10},
+		{"copyright only", MetadataCopyright, ".jpg", true, false, true, 0, 0},
+	}
+
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "photo.jpg")
+	if err := os.WriteFile(inputPath, src, 0o600); err != nil {
+		t.Fatalf("Failed to write input: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(Options{Width: 10, Metadata: tt.mode})
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+
+			outputPath := filepath.Join(tempDir, tt.name+tt.outputExt)
+			if _, err := r.ResizeFile(context.Background(), inputPath, outputPath); err != nil {
+				t.Fatalf("ResizeFile() returned error: %v", err)
+			}
+
+			out, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if tt.outputExt == ".png" {
+				if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+					t.Fatalf("output is not a valid PNG: %v", err)
+				}
+			} else if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+				t.Fatalf("output is not a valid JPEG: %v", err)
+			}
+
+			format, err := FormatFromFilename(outputPath)
+			if err != nil {
+				t.Fatalf("FormatFromFilename() returned error: %v", err)
+			}
+			md := readMetadata(out, format)
+
+			if (md.exif != nil) != tt.wantEXIF {
+				t.Errorf("EXIF present = %v, want %v", md.exif != nil, tt.wantEXIF)
+			}
+			if (md.xmp != nil) != tt.wantXMP {
+				t.Errorf("XMP present = %v, want %v", md.xmp != nil, tt.wantXMP)
+			}
+			if tt.wantXMP && !bytes.Equal(md.xmp, xmp) {
+				t.Errorf("XMP = %q, want %q", md.xmp, xmp)
+			}
+			if tt.wantICC && !bytes.Equal(md.icc, icc) {
+				t.Errorf("ICC profile not preserved (got %d bytes, want %d)", len(md.icc), len(icc))
+			}
+			if !tt.wantICC && md.icc != nil {
+				t.Errorf("ICC profile present, want stripped")
+			}
+			if !tt.wantEXIF {
+				return
+			}
+
+			if _, copyright := exifTag(t, md.exif, tagCopyright); copyright != "ACME Corp" {
+				t.Errorf("Copyright = %q, want %q", copyright, "ACME Corp")
+			}
+			if orient, _ := exifTag(t, md.exif, tagOrientation); orient != tt.wantOrient {
+				t.Errorf("Orientation = %d, want %d", orient, tt.wantOrient)
+			}
+			if px, _ := exifTag(t, md.exif, tagPixelXDimension); px != tt.wantPixelsX {
+				t.Errorf("PixelXDimension = %d, want %d", px, tt.wantPixelsX)
+			}
+		})
+	}
+}
+
+func TestFixupEXIFKeepsOrientationWhenNotOriented(t *testing.T) {
+	exif := fixupEXIF(testEXIF(6, "x", 40, 20), false, 10, 5)
+	if orient, _ := exifTag(t, exif, tagOrientation); orient != 6 {
+		t.Errorf("Orientation = %d, want 6", orient)
+	}
+	if py, _ := exifTag(t, exif, tagPixelYDimension); py != 5 {
+		t.Errorf("PixelYDimension = %d, want 5", py)
+	}
+}
+
+func TestResizeMetadataKeepsPNGOrientation(t *testing.T) {
+	// Orientation in a PNG eXIf chunk is not applied on decode, so the tag must survive
+	var plain bytes.Buffer
+	if err := png.Encode(&plain, newTestImage(40, 20)); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	src := writePNGMetadata(plain.Bytes(), metadata{exif: testEXIF(6, "x", 40, 20)})
+
+	r, err := New(Options{Width: 10, Metadata: MetadataKeep})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	var out bytes.Buffer
+	result, err := r.Resize(context.Background(), bytes.NewReader(src), &out)
+	if err != nil {
+		t.Fatalf("Resize() returned error: %v", err)
+	}
+	if result.Width != 10 || result.Height != 5 {
+		t.Errorf("Resize() = %dx%d, want 10x5 (pixels not rotated)", result.Width, result.Height)
+	}
+
+	md := readMetadata(out.Bytes(), FormatPNG)
+	if orient, _ := exifTag(t, md.exif, tagOrientation); orient != 6 {
+		t.Errorf("Orientation = %d, want 6", orient)
+	}
+}
+
+func TestReadPNGMetadataIgnoresOtherTextChunks(t *testing.T) {
+	var plain bytes.Buffer
+	if err := png.Encode(&plain, newTestImage(4, 4)); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"/>`)
+	data := writePNGMetadata(plain.Bytes(), metadata{xmp: xmp})
+
+	// Add a Comment iTXt chunk after the XMP one, in front of the 12-byte IEND chunk
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-12])
+	writePNGChunk(&buf, "iTXt", []byte("Comment\x00\x00\x00\x00\x00a comment"))
+	buf.Write(data[len(data)-12:])
+
+	if md := readPNGMetadata(buf.Bytes()); !bytes.Equal(md.xmp, xmp) {
+		t.Errorf("XMP = %q, want %q", md.xmp, xmp)
+	}
+}
@@ -0,0 +1,117 @@
+package resize
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Mode selects how an image is resized when both Width and Height are set.
+type Mode string
+
+// Supported resize modes.
+const (
+	ModeStretch Mode = "stretch" // Scale to exactly Width x Height, ignoring the aspect ratio
+	ModeFit     Mode = "fit"     // Scale to fit within Width x Height, keeping the aspect ratio
+	ModeFill    Mode = "fill"    // Scale to cover Width x Height, then crop to exactly that size
+	ModePad     Mode = "pad"     // Fit within Width x Height, then pad to exactly that size
+)
+
+// modes lists the valid Mode values in the order they are documented.
+var modes = []Mode{ModeFit, ModeFill, ModePad, ModeStretch}
+
+// ParseMode converts a case-insensitive mode name into a Mode.
+func ParseMode(s string) (Mode, error) {
+	m := Mode(strings.ToLower(strings.TrimSpace(s)))
+	for _, valid := range modes {
+		if m == valid {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("invalid mode %q (valid: fit, fill, pad, stretch)", s)
+}
+
+/*
+Anchor selects which part of the image is kept when ModeFill crops it, or
+where the image is placed on the canvas in ModePad.
+*/
+type Anchor string
+
+// Supported crop anchors.
+const (
+	AnchorCenter      Anchor = "center"
+	AnchorTopLeft     Anchor = "top-left"
+	AnchorTop         Anchor = "top"
+	AnchorTopRight    Anchor = "top-right"
+	AnchorLeft        Anchor = "left"
+	AnchorRight       Anchor = "right"
+	AnchorBottomLeft  Anchor = "bottom-left"
+	AnchorBottom      Anchor = "bottom"
+	AnchorBottomRight Anchor = "bottom-right"
+)
+
+// anchors maps each Anchor to the equivalent imaging anchor point.
+var anchors = map[Anchor]imaging.Anchor{
+	AnchorCenter:      imaging.Center,
+	AnchorTopLeft:     imaging.TopLeft,
+	AnchorTop:         imaging.Top,
+	AnchorTopRight:    imaging.TopRight,
+	AnchorLeft:        imaging.Left,
+	AnchorRight:       imaging.Right,
+	AnchorBottomLeft:  imaging.BottomLeft,
+	AnchorBottom:      imaging.Bottom,
+	AnchorBottomRight: imaging.BottomRight,
+}
+
+// ParseAnchor converts a case-insensitive anchor name such as "bottom-left" into an Anchor.
+func ParseAnchor(s string) (Anchor, error) {
+	a := Anchor(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := anchors[a]; !ok {
+		return "", fmt.Errorf(
+			"invalid anchor %q (valid: center, top, bottom, left, right, top-left, top-right, bottom-left, bottom-right)",
+			s,
+		)
+	}
+	return a, nil
+}
+
+/*
+position returns the top-left point at which an image of size inner is
+placed inside outer so that it is aligned to the anchor.
+*/
+func (a Anchor) position(outer, inner image.Point) image.Point {
+	dx, dy := outer.X-inner.X, outer.Y-inner.Y
+	pt := image.Pt(dx/2, dy/2)
+
+	switch a {
+	case AnchorTopLeft:
+		pt = image.Pt(0, 0)
+	case AnchorTop:
+		pt.Y = 0
+	case AnchorTopRight:
+		pt = image.Pt(dx, 0)
+	case AnchorLeft:
+		pt.X = 0
+	case AnchorRight:
+		pt.X = dx
+	case AnchorBottomLeft:
+		pt = image.Pt(0, dy)
+	case AnchorBottom:
+		pt.Y = dy
+	case AnchorBottomRight:
+		pt = image.Pt(dx, dy)
+	case AnchorCenter:
+	}
+
+	return pt
+}
+
+// imagingAnchor returns the imaging anchor for a, defaulting to the center.
+func (a Anchor) imagingAnchor() imaging.Anchor {
+	if anchor, ok := anchors[a]; ok {
+		return anchor
+	}
+	return imaging.Center
+}
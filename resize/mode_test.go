@@ -0,0 +1,187 @@
+package resize
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Mode
+		wantErr  bool
+	}{
+		{"fit", ModeFit, false},
+		{"FILL", ModeFill, false},
+		{" stretch ", ModeStretch, false},
+		{"crop", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMode(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseMode(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseAnchor(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Anchor
+		wantErr  bool
+	}{
+		{"center", AnchorCenter, false},
+		{"Bottom-Left", AnchorBottomLeft, false},
+		{"top", AnchorTop, false},
+		{"middle", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseAnchor(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAnchor(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("ParseAnchor(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestKeepRatioConflictsWithMode(t *testing.T) {
+	if _, err := New(Options{Width: 10, Height: 10, KeepRatio: true, Mode: ModeFill}); err == nil {
+		t.Error("expected an error combining KeepRatio with ModeFill")
+	}
+	if _, err := New(Options{Width: 10, Height: 10, KeepRatio: true, Mode: ModeFit}); err != nil {
+		t.Errorf("unexpected error combining KeepRatio with ModeFit: %v", err)
+	}
+}
+
+func TestResizeModes(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "wide.png")
+	writeTestPNG(t, inputPath, 400, 200)
+
+	tests := []struct {
+		name           string
+		opts           Options
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{"stretch", Options{Width: 100, Height: 100, Mode: ModeStretch}, 100, 100},
+		{"fit", Options{Width: 100, Height: 100, Mode: ModeFit}, 100, 50},
+		{"fill", Options{Width: 100, Height: 100, Mode: ModeFill}, 100, 100},
+		{"default is stretch", Options{Width: 100, Height: 100}, 100, 100},
+		{"keep ratio is fit", Options{Width: 100, Height: 100, KeepRatio: true}, 100, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.OutputDir = filepath.Join(tempDir, tt.name)
+			r, err := New(tt.opts)
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+
+			result, err := r.ResizeFile(context.Background(), inputPath, "")
+			if err != nil {
+				t.Fatalf("ResizeFile() returned error: %v", err)
+			}
+			if result.Width != tt.expectedWidth || result.Height != tt.expectedHeight {
+				t.Errorf("size = %dx%d, want %dx%d",
+					result.Width, result.Height, tt.expectedWidth, tt.expectedHeight)
+			}
+		})
+	}
+}
+
+func TestFillAnchor(t *testing.T) {
+	// Left half red, right half blue: anchoring the square crop to either
+	// side must keep only that side's color.
+	src := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	for y := range 100 {
+		for x := range 200 {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 100 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+
+	tests := []struct {
+		anchor  Anchor
+		wantRed bool
+	}{
+		{AnchorLeft, true},
+		{AnchorRight, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.anchor), func(t *testing.T) {
+			r, err := New(Options{Width: 50, Height: 50, Mode: ModeFill, Anchor: tt.anchor})
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+
+			result := r.newResult(src)
+			resized := r.scale(src, result)
+			red, _, blue, _ := resized.At(25, 25).RGBA()
+			if gotRed := red > blue; gotRed != tt.wantRed {
+				t.Errorf("anchor %s: center pixel red=%d blue=%d", tt.anchor, red, blue)
+			}
+		})
+	}
+}
+
+func TestPadMode(t *testing.T) {
+	src := newTestImage(400, 200)
+
+	tests := []struct {
+		name       string
+		background color.NRGBA
+		anchor     Anchor
+		probe      image.Point // a pixel that must be background
+	}{
+		{"centered white", color.NRGBA{255, 255, 255, 255}, AnchorCenter, image.Pt(50, 5)},
+		{"top transparent", color.NRGBA{}, AnchorTop, image.Pt(50, 95)},
+		{"bottom red", color.NRGBA{255, 0, 0, 255}, AnchorBottom, image.Pt(50, 5)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(Options{
+				Width:      100,
+				Height:     100,
+				Mode:       ModePad,
+				Anchor:     tt.anchor,
+				Background: tt.background,
+			})
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+
+			result := r.newResult(src)
+			padded := r.scale(src, result)
+			if result.Width != 100 || result.Height != 100 {
+				t.Fatalf("size = %dx%d, want 100x100", result.Width, result.Height)
+			}
+
+			got := color.NRGBAModel.Convert(padded.At(tt.probe.X, tt.probe.Y)).(color.NRGBA)
+			if got != tt.background {
+				t.Errorf("pixel at %v = %v, want background %v", tt.probe, got, tt.background)
+			}
+		})
+	}
+}
@@ -0,0 +1,352 @@
+package resize
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultNameTemplate is the NameTemplate that produces names like photo_800x600.jpg.
+const DefaultNameTemplate = "{name}_{w}x{h}{ext}"
+
+// Placeholders supported in a NameTemplate.
+const (
+	placeholderName       = "name"  // Input file name without extension
+	placeholderExt        = "ext"   // Output extension including the dot
+	placeholderWidth      = "w"     // Output width
+	placeholderHeight     = "h"     // Output height
+	placeholderOrigWidth  = "origW" // Source width
+	placeholderOrigHeight = "origH" // Source height
+	placeholderHash       = "hash8" // First 8 hex digits of the SHA-256 of the input
+	placeholderDate       = "date"  // Modification date of the input (YYYY-MM-DD)
+	placeholderDir        = "dir"   // Name of the directory containing the input
+)
+
+// NamePlaceholders lists the placeholders a NameTemplate may use, for help texts.
+const NamePlaceholders = "{name}, {ext}, {w}, {h}, {origW}, {origH}, {hash8}, {date}, {dir}"
+
+var placeholders = []string{
+	placeholderName, placeholderExt, placeholderWidth, placeholderHeight,
+	placeholderOrigWidth, placeholderOrigHeight, placeholderHash, placeholderDate, placeholderDir,
+}
+
+/*
+parseNameTemplate splits a template into literal text and placeholder names.
+Placeholders are returned with their braces so they can be told apart.
+*/
+func parseNameTemplate(tmpl string) ([]string, error) {
+	var parts []string
+	for tmpl != "" {
+		start := strings.IndexAny(tmpl, "{}")
+		if start < 0 {
+			parts = append(parts, tmpl)
+			break
+		}
+		if tmpl[start] == '}' {
+			return nil, fmt.Errorf("invalid name template: unexpected '}'")
+		}
+		end := strings.IndexByte(tmpl[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid name template: unclosed '{'")
+		}
+		name := tmpl[start+1 : start+end]
+		if !slices.Contains(placeholders, name) {
+			return nil, fmt.Errorf("invalid name template: unknown placeholder {%s} (valid: %s)",
+				name, NamePlaceholders)
+		}
+		if start > 0 {
+			parts = append(parts, tmpl[:start])
+		}
+		parts = append(parts, "{"+name+"}")
+		tmpl = tmpl[start+end+1:]
+	}
+	return parts, nil
+}
+
+/*
+ValidateNameTemplate checks that tmpl only uses known placeholders and names
+every output uniquely: it must contain {ext} so the format can be told from
+the name, {name} or {hash8} to tell inputs apart, and with several sizes {w}
+or {h} to tell the variants of one input apart. Sizes sharing the dimension
+the template names, such as 60x40 and 60x30 for "{name}_{w}{ext}", need the
+other one as well. It may create subdirectories but must not point outside of
+the output directory.
+*/
+func ValidateNameTemplate(tmpl string, sizes []Size) error {
+	parts, err := parseNameTemplate(tmpl)
+	if err != nil {
+		return err
+	}
+	has := func(name string) bool { return slices.Contains(parts, "{"+name+"}") }
+
+	switch {
+	case !has(placeholderExt):
+		return errors.New("invalid name template: {ext} is required")
+	case !has(placeholderName) && !has(placeholderHash):
+		return errors.New("invalid name template: {name} or {hash8} is required to keep names unique")
+	case len(sizes) > 1 && !has(placeholderWidth) && !has(placeholderHeight):
+		return errors.New("invalid name template: {w} or {h} is required with several sizes")
+	case !has(placeholderHeight) && sharedDimension(sizes, func(s Size) int { return s.Width }):
+		return errors.New("invalid name template: {h} is required for sizes of the same width")
+	case !has(placeholderWidth) && sharedDimension(sizes, func(s Size) int { return s.Height }):
+		return errors.New("invalid name template: {w} is required for sizes of the same height")
+	case filepath.IsAbs(tmpl) || slices.Contains(strings.Split(filepath.ToSlash(tmpl), "/"), ".."):
+		return errors.New("invalid name template: must stay inside the output directory")
+	}
+	return nil
+}
+
+// sharedDimension reports whether two sizes set the same non-zero dimension.
+func sharedDimension(sizes []Size, dimension func(Size) int) bool {
+	seen := map[int]bool{}
+	for _, size := range sizes {
+		d := dimension(size)
+		if d != 0 && seen[d] {
+			return true
+		}
+		seen[d] = true
+	}
+	return false
+}
+
+/*
+IsOutput reports whether the file at path looks like an output these options
+generated in an earlier run: its name matches the NameTemplate and, if the
+template contains {name}, an image with that name exists where the input
+would have been (next to the output, or at the mirrored place below
+InputRoot when OutputDir is set). With Overwrite outputs replace their inputs,
+so nothing is reported. Use an OutputMatcher to check many files.
+*/
+func (o Options) IsOutput(path string) bool {
+	return o.NewOutputMatcher().IsOutput(path)
+}
+
+/*
+OutputMatcher answers IsOutput for many files: the NameTemplate is compiled
+once and each input directory is listed only once, however many candidate
+outputs it has. It is not safe for concurrent use.
+*/
+type OutputMatcher struct {
+	opts   Options
+	re     *regexp.Regexp                 // Compiled NameTemplate; nil if nothing can match
+	depth  int                            // Path elements a name produced by the template spans
+	inputs map[string]map[string][]string // Image files per directory, by name without extension
+}
+
+// NewOutputMatcher returns an OutputMatcher for the options.
+func (o Options) NewOutputMatcher() *OutputMatcher {
+	m := &OutputMatcher{opts: o, inputs: map[string]map[string][]string{}}
+	if o.Overwrite {
+		return m
+	}
+	tmpl := o.NameTemplate
+	if tmpl == "" {
+		tmpl = DefaultNameTemplate
+	}
+	if re, err := nameRegexp(tmpl); err == nil {
+		m.re = re
+		m.depth = strings.Count(filepath.ToSlash(tmpl), "/") + 1
+	}
+	return m
+}
+
+// IsOutput reports whether the file at path looks like an earlier output, see Options.IsOutput.
+func (m *OutputMatcher) IsOutput(path string) bool {
+	if m.re == nil {
+		return false
+	}
+
+	// The template may create subdirectories, so match as many trailing path elements
+	elems := strings.Split(filepath.ToSlash(path), "/")
+	if len(elems) < m.depth {
+		return false
+	}
+	match := m.re.FindStringSubmatch(strings.Join(elems[len(elems)-m.depth:], "/"))
+	if match == nil {
+		return false
+	}
+	group := m.re.SubexpIndex(placeholderName)
+	if group < 0 {
+		// Names made only of a hash cannot be traced back to their input
+		return true
+	}
+
+	inputDir := filepath.FromSlash(strings.Join(elems[:len(elems)-m.depth], "/"))
+	if inputDir == "" {
+		inputDir = "."
+	}
+	if o := m.opts; o.OutputDir != "" {
+		rel, err := filepath.Rel(o.OutputDir, inputDir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			// Outside of the output directory, so not written by these options
+			return false
+		}
+		if o.InputRoot == "" {
+			// Inputs from anywhere are written directly into OutputDir
+			return true
+		}
+		inputDir = filepath.Join(o.InputRoot, rel)
+	}
+
+	// The input may have had another extension if the format was converted
+	for _, input := range m.imagesIn(inputDir)[match[group]] {
+		if input != filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+imagesIn lists the image files in dir by name without extension, reading dir
+only once. Files without an extension count if their content is an image.
+*/
+func (m *OutputMatcher) imagesIn(dir string) map[string][]string {
+	if images, ok := m.inputs[dir]; ok {
+		return images
+	}
+	images := map[string][]string{}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if _, err := FormatFromFilename(name); err != nil {
+			if filepath.Ext(name) != "" {
+				continue
+			}
+			if _, err := DetectFileFormat(path); err != nil {
+				continue
+			}
+		}
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		images[stem] = append(images[stem], path)
+	}
+	m.inputs[dir] = images
+	return images
+}
+
+/*
+nameRegexp compiles a NameTemplate into a regular expression matching the
+names it produces, with the first {name} captured as a group of that name.
+*/
+func nameRegexp(tmpl string) (*regexp.Regexp, error) {
+	parts, err := parseNameTemplate(filepath.ToSlash(tmpl))
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	captured := false
+	for _, part := range parts {
+		switch part {
+		case "{" + placeholderName + "}":
+			if !captured {
+				// Lazy, so that an optional {ext} right after it still takes the extension
+				b.WriteString("(?P<" + placeholderName + ">[^/]+?)")
+				captured = true
+			} else {
+				b.WriteString("[^/]+")
+			}
+		case "{" + placeholderExt + "}":
+			// Inputs without an extension produce outputs without one
+			b.WriteString(`(?:\.[^./]+)?`)
+		case "{" + placeholderWidth + "}", "{" + placeholderHeight + "}",
+			"{" + placeholderOrigWidth + "}", "{" + placeholderOrigHeight + "}":
+			b.WriteString("[0-9]+")
+		case "{" + placeholderHash + "}":
+			b.WriteString("[0-9a-f]{8}")
+		case "{" + placeholderDate + "}":
+			b.WriteString("[0-9]{4}-[0-9]{2}-[0-9]{2}")
+		case "{" + placeholderDir + "}":
+			b.WriteString("[^/]+")
+		default:
+			b.WriteString(regexp.QuoteMeta(part))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// nameData holds the values NameTemplate placeholders expand to.
+type nameData struct {
+	width, height         int
+	origWidth, origHeight int
+	format                Format // Input format detected from the content, for FixExtension
+	data                  []byte // Input bytes for {hash8}; read from the file when nil
+}
+
+/*
+expandName expands the NameTemplate (DefaultNameTemplate if unset) for
+inputPath, where base is the input file name without extension and ext the
+output extension. The template was checked by validate.
+*/
+func (o Options) expandName(inputPath, base, ext string, d nameData) string {
+	tmpl := o.NameTemplate
+	if tmpl == "" {
+		tmpl = DefaultNameTemplate
+	}
+	parts, err := parseNameTemplate(tmpl)
+	if err != nil {
+		return base + ext
+	}
+
+	var b strings.Builder
+	for _, part := range parts {
+		switch part {
+		case "{" + placeholderName + "}":
+			b.WriteString(base)
+		case "{" + placeholderExt + "}":
+			b.WriteString(ext)
+		case "{" + placeholderWidth + "}":
+			b.WriteString(strconv.Itoa(d.width))
+		case "{" + placeholderHeight + "}":
+			b.WriteString(strconv.Itoa(d.height))
+		case "{" + placeholderOrigWidth + "}":
+			b.WriteString(strconv.Itoa(d.origWidth))
+		case "{" + placeholderOrigHeight + "}":
+			b.WriteString(strconv.Itoa(d.origHeight))
+		case "{" + placeholderHash + "}":
+			b.WriteString(inputHash(inputPath, d.data))
+		case "{" + placeholderDate + "}":
+			b.WriteString(modDate(inputPath))
+		case "{" + placeholderDir + "}":
+			b.WriteString(filepath.Base(filepath.Dir(inputPath)))
+		default:
+			b.WriteString(part)
+		}
+	}
+	return filepath.FromSlash(b.String())
+}
+
+// inputHash returns the first 8 hex digits of the SHA-256 of data, or of the file at path.
+func inputHash(path string, data []byte) string {
+	if data == nil {
+		var err error
+		// #nosec G304 -- hashing the user-specified input
+		if data, err = os.ReadFile(path); err != nil {
+			return "00000000"
+		}
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:4])
+}
+
+// modDate returns the modification date of the file at path as YYYY-MM-DD.
+func modDate(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "0000-00-00"
+	}
+	return info.ModTime().Format("2006-01-02")
+}
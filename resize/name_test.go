@@ -0,0 +1,216 @@
+package resize
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidateNameTemplate(t *testing.T) {
+	several := []Size{{Width: 320}, {Width: 640}}
+	tests := []struct {
+		name    string
+		tmpl    string
+		sizes   []Size
+		wantErr bool
+	}{
+		{"default", DefaultNameTemplate, several, false},
+		{"retina", "{name}@2x{ext}", nil, false},
+		{"width suffix", "{name}-w{w}{ext}", several, false},
+		{"hash only", "{hash8}{ext}", nil, false},
+		{"subdirectory", "{w}/{name}{ext}", several, false},
+		{"all placeholders", "{dir}-{name}-{w}x{h}-{origW}x{origH}-{hash8}-{date}{ext}", several, false},
+		{"missing ext", "{name}_{w}", nil, true},
+		{"missing name", "thumb_{w}{ext}", nil, true},
+		{"sizes without dimensions", "{name}@2x{ext}", several, true},
+		{"same width without height", "{name}_{w}{ext}", []Size{{60, 40}, {60, 30}}, true},
+		{"same height without width", "{name}_{h}{ext}", []Size{{40, 60}, {30, 60}}, true},
+		{"same width with height", "{name}_{w}x{h}{ext}", []Size{{60, 40}, {60, 30}}, false},
+		{"single size", "{name}{ext}", []Size{{Width: 60}}, false},
+		{"unknown placeholder", "{name}_{width}{ext}", nil, true},
+		{"unclosed brace", "{name{ext}", nil, true},
+		{"stray brace", "{name}}{ext}", nil, true},
+		{"parent directory", "../{name}{ext}", nil, true},
+		{"absolute", "/tmp/{name}{ext}", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateNameTemplate(tt.tmpl, tt.sizes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNameTemplate(%q) error = %v, wantErr %v", tt.tmpl, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOutputPathNameTemplate(t *testing.T) {
+	input := filepath.Join("assets", "icons", "logo.png")
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{"default matches the classic pattern", Options{}, filepath.Join("assets", "icons", "logo_80x60.png")},
+		{"explicit default", Options{NameTemplate: DefaultNameTemplate}, filepath.Join("assets", "icons", "logo_80x60.png")},
+		{"retina", Options{NameTemplate: "{name}@2x{ext}"}, filepath.Join("assets", "icons", "logo@2x.png")},
+		{"width with format", Options{NameTemplate: "{name}-w{w}{ext}", Format: FormatWebP}, filepath.Join("assets", "icons", "logo-w80.webp")},
+		{"dir and subdirectory", Options{NameTemplate: "{w}/{dir}-{name}{ext}", OutputDir: "out"}, filepath.Join("out", "80", "icons-logo.png")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.OutputPath(input, 80, 60); got != tt.expected {
+				t.Errorf("OutputPath() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResizeFileNameTemplate(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo.png")
+	writeTestPNG(t, input, 80, 60)
+	date := time.Date(2024, 3, 9, 12, 0, 0, 0, time.Local)
+	if err := os.Chtimes(input, date, date); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	data, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatalf("Failed to read input: %v", err)
+	}
+	sum := sha256.Sum256(data)
+
+	r, err := New(Options{Width: 40, NameTemplate: "{name}-{origW}x{origH}-{w}x{h}-{hash8}-{date}{ext}"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	result, err := r.ResizeFile(context.Background(), input, "")
+	if err != nil {
+		t.Fatalf("ResizeFile() error = %v", err)
+	}
+
+	want := filepath.Join(dir, "photo-80x60-40x30-"+hex.EncodeToString(sum[:4])+"-2024-03-09.png")
+	if result.OutputPath != want {
+		t.Errorf("OutputPath = %q, want %q", result.OutputPath, want)
+	}
+	if _, err := os.Stat(want); err != nil {
+		t.Errorf("Expected output file: %v", err)
+	}
+
+	// Plan computes the same name from the header alone
+	planned, err := r.Plan(input)
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if planned[0].OutputPath != want {
+		t.Errorf("Plan() OutputPath = %q, want %q", planned[0].OutputPath, want)
+	}
+}
+
+func TestNewRejectsNameTemplateWithOverwrite(t *testing.T) {
+	if _, err := New(Options{Width: 40, Overwrite: true, NameTemplate: "{name}@2x{ext}"}); err == nil {
+		t.Error("New() expected an error for a name template with overwrite")
+	}
+}
+
+func TestOptionsIsOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{
+		"photo.jpg",
+		"photo_800x600.jpg",
+		"photo_800x600_800x600.jpg",
+		"banner_1920x1080.png",
+		"scan.tiff",
+		"scan_640x480.webp",
+		filepath.Join("thumbs", "photo.jpg"),
+		filepath.Join("src", "a", "logo.png"),
+		filepath.Join("out", "a", "logo_100x100.png"),
+		filepath.Join("out", "a", "orphan_100x100.png"),
+	} {
+		writeTestPNG(t, filepath.Join(tempDir, name), 1, 1)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		path string
+		want bool
+	}{
+		{"default template", Options{}, "photo_800x600.jpg", true},
+		{"output of an output", Options{}, "photo_800x600_800x600.jpg", true},
+		{"input", Options{}, "photo.jpg", false},
+		{"matching name without input", Options{}, "banner_1920x1080.png", false},
+		{"converted format", Options{}, "scan_640x480.webp", true},
+		{"custom template", Options{NameTemplate: "{name}_{w}x{h}{ext}"}, "photo_800x600.jpg", true},
+		{"other template", Options{NameTemplate: "{name}-w{w}{ext}"}, "photo_800x600.jpg", false},
+		{"template subdirectory", Options{NameTemplate: "thumbs/{name}{ext}"}, filepath.Join("thumbs", "photo.jpg"), true},
+		{"overwrite", Options{Overwrite: true}, "photo_800x600.jpg", false},
+		{"hash template", Options{NameTemplate: "{hash8}{ext}"}, "photo.jpg", false},
+		{
+			"mirrored output directory",
+			Options{OutputDir: filepath.Join(tempDir, "out"), InputRoot: filepath.Join(tempDir, "src")},
+			filepath.Join("out", "a", "logo_100x100.png"),
+			true,
+		},
+		{
+			"mirrored output without input",
+			Options{OutputDir: filepath.Join(tempDir, "out"), InputRoot: filepath.Join(tempDir, "src")},
+			filepath.Join("out", "a", "orphan_100x100.png"),
+			false,
+		},
+		{
+			"outside of the output directory",
+			Options{OutputDir: filepath.Join(tempDir, "out"), InputRoot: filepath.Join(tempDir, "src")},
+			"photo_800x600.jpg",
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.IsOutput(filepath.Join(tempDir, tt.path)); got != tt.want {
+				t.Errorf("IsOutput(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputMatcher(t *testing.T) {
+	tempDir := t.TempDir()
+	var inputs, outputs []string
+	for i := range 50 {
+		inputs = append(inputs, filepath.Join(tempDir, fmt.Sprintf("img%02d.png", i)))
+		outputs = append(outputs, filepath.Join(tempDir, fmt.Sprintf("img%02d_10x10.png", i)))
+	}
+	for _, path := range append(slices.Clone(inputs), outputs...) {
+		writeTestPNG(t, path, 1, 1)
+	}
+
+	m := Options{}.NewOutputMatcher()
+	for _, path := range inputs {
+		if m.IsOutput(path) {
+			t.Errorf("IsOutput(%q) = true, want false", path)
+		}
+	}
+	for _, path := range outputs {
+		if !m.IsOutput(path) {
+			t.Errorf("IsOutput(%q) = false, want true", path)
+		}
+	}
+
+	// The directory was listed once, so an input added since is not seen
+	writeTestPNG(t, filepath.Join(tempDir, "late.png"), 1, 1)
+	if m.IsOutput(filepath.Join(tempDir, "late_10x10.png")) {
+		t.Error("OutputMatcher listed the directory again")
+	}
+	if !(Options{}).IsOutput(filepath.Join(tempDir, "late_10x10.png")) {
+		t.Error("IsOutput() did not find the new input")
+	}
+}
@@ -0,0 +1,226 @@
+package resize
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+)
+
+// DefaultQuality is the JPEG quality used when Options.Quality is left at zero.
+const DefaultQuality = 95
+
+/*
+Options controls how a Resizer scales and writes images. A zero Width or
+Height means that dimension is derived from the other one so the original
+aspect ratio is preserved; at least one of them must be positive unless
+Sizes, Scale, MaxSize or MinSize is set instead.
+*/
+type Options struct {
+	Width     int    // Output width in pixels (0 = auto based on Height)
+	Height    int    // Output height in pixels (0 = auto based on Width)
+	KeepRatio bool   // Shorthand for Mode = ModeFit
+	Mode      Mode   // How to resize when both dimensions are set (default: ModeStretch)
+	Anchor    Anchor // Crop position for ModeFill, placement for ModePad (default: AnchorCenter)
+	Filter    Filter // Resampling filter (default: FilterLanczos)
+	Format    Format // Output format (default: same as the input)
+	Quality   int    // JPEG and lossy WebP quality (1-100, 0 = DefaultQuality)
+	Lossless  bool   // Encode WebP losslessly (Quality is ignored)
+	OutputDir string // Directory for generated files (default: next to the input)
+	Overwrite bool   // Replace the input file instead of writing a new one
+
+	// FixExtension names outputs with the extension of the format detected
+	// from the input content when the input file's extension is missing or
+	// wrong (a PNG saved as photo.jpg is written as photo_800x600.png).
+	FixExtension bool
+
+	// InputRoot mirrors the directory tree below it under OutputDir: an input
+	// at InputRoot/a/b.jpg is written to OutputDir/a/. Inputs outside of
+	// InputRoot, or an empty InputRoot, are written directly into OutputDir.
+	InputRoot string
+
+	// NameTemplate names generated files (default: DefaultNameTemplate); see
+	// NamePlaceholders for the placeholders. It cannot be used with Overwrite.
+	NameTemplate string
+
+	// Backup keeps a copy of a file before it is replaced: a directory (if it
+	// contains a path separator or exists) or a suffix such as ".bak".
+	Backup string
+
+	// Scale resizes by a factor of the original size (0.5 = 50%), MaxSize
+	// to a longest edge and MinSize to a shortest edge in pixels, whatever
+	// the orientation. They replace Width and Height and keep the aspect ratio.
+	Scale   float64
+	MaxSize int
+	MinSize int
+
+	// Sizes lists several output sizes generated from a single decode by
+	// ResizeFileVariants. Each entry replaces Width and Height for its variant.
+	Sizes []Size
+
+	// Metadata selects which EXIF, XMP and ICC metadata is copied from the
+	// source to the output (default: MetadataStrip).
+	Metadata MetadataMode
+
+	// NoUpscale leaves images alone that would have to be enlarged, and
+	// OnlyEnlarge those that would not; both return ErrWithinBounds.
+	NoUpscale   bool
+	OnlyEnlarge bool
+
+	// OnlyShrinkLargerThan leaves images alone unless they are wider than its
+	// Width or taller than its Height (zero dimensions are not checked).
+	OnlyShrinkLargerThan Size
+
+	// MaxPixels rejects images whose header declares more pixels, before
+	// they are decoded, and MaxInputBytes larger input files (0 = no limit).
+	// Rejected images return an error wrapping ErrLimitExceeded.
+	MaxPixels     int64
+	MaxInputBytes int64
+
+	// MemoryBudget caps the estimated memory, in bytes, of the images a
+	// Resizer decodes at the same time; calls wait until enough of it is
+	// free (0 = no limit).
+	MemoryBudget int64
+
+	// NoAutoOrient disables applying the EXIF orientation tag on decode, so
+	// JPEGs are processed in their stored (possibly sideways) orientation.
+	NoAutoOrient bool
+
+	// Background fills the canvas around the image in ModePad and replaces
+	// transparency when encoding to a format without alpha (JPEG, BMP). The
+	// zero value is transparent; flattening then falls back to white.
+	Background color.NRGBA
+}
+
+// validate checks the options for values the resizer cannot work with.
+func (o Options) validate() error {
+	if o.Width < 0 || o.Height < 0 {
+		return errors.New("width and height must be positive numbers")
+	}
+	if o.Scale < 0 || o.MaxSize < 0 || o.MinSize < 0 {
+		return errors.New("scale, max size and min size must be positive")
+	}
+	switch n := o.sizings(); {
+	case n == 0:
+		return errors.New("at least one of width or height must be specified")
+	case n > 1:
+		return errors.New("only one of width/height, sizes, scale, max size or min size can be set")
+	}
+	for _, size := range o.Sizes {
+		if size.Width < 0 || size.Height < 0 || size.Width == 0 && size.Height == 0 {
+			return fmt.Errorf("invalid size %s: dimensions must be positive", size)
+		}
+	}
+	if o.Overwrite && len(o.Sizes) > 1 {
+		return errors.New("overwrite cannot be combined with multiple sizes")
+	}
+	if o.NoUpscale && o.OnlyEnlarge {
+		return errors.New("no-upscale cannot be combined with only-enlarge")
+	}
+	if o.OnlyShrinkLargerThan.Width < 0 || o.OnlyShrinkLargerThan.Height < 0 {
+		return errors.New("only-shrink-larger-than dimensions must be positive")
+	}
+	if o.OnlyEnlarge && (o.OnlyShrinkLargerThan.Width > 0 || o.OnlyShrinkLargerThan.Height > 0) {
+		return errors.New("only-enlarge cannot be combined with only-shrink-larger-than")
+	}
+	if o.MaxPixels < 0 || o.MaxInputBytes < 0 || o.MemoryBudget < 0 {
+		return errors.New("max pixels, max input bytes and memory budget must be positive")
+	}
+	if o.Quality < 0 || o.Quality > 100 {
+		return errors.New("quality must be between 1 and 100")
+	}
+	if o.Mode != "" {
+		if _, err := ParseMode(string(o.Mode)); err != nil {
+			return err
+		}
+		if o.KeepRatio && o.Mode != ModeFit {
+			return fmt.Errorf("keep-ratio cannot be combined with mode %q", o.Mode)
+		}
+	}
+	if o.Filter != "" {
+		if _, err := ParseFilter(string(o.Filter)); err != nil {
+			return err
+		}
+	}
+	if o.Format != "" {
+		if _, err := ParseFormat(string(o.Format)); err != nil {
+			return err
+		}
+	}
+	if o.Metadata != "" {
+		if _, err := ParseMetadataMode(string(o.Metadata)); err != nil {
+			return err
+		}
+	}
+	if o.Anchor != "" {
+		if _, err := ParseAnchor(string(o.Anchor)); err != nil {
+			return err
+		}
+	}
+	if o.Overwrite && o.OutputDir != "" {
+		return errors.New("overwrite cannot be combined with an output directory")
+	}
+	if o.NameTemplate != "" {
+		if o.Overwrite {
+			return errors.New("name template cannot be combined with overwrite")
+		}
+		if err := ValidateNameTemplate(o.NameTemplate, o.Sizes); err != nil {
+			return err
+		}
+	}
+	if o.Backup != "" && !o.Overwrite {
+		return errors.New("backup requires overwrite")
+	}
+	return nil
+}
+
+// sizings counts how many of the mutually exclusive ways to size the output are set.
+func (o Options) sizings() int {
+	n := 0
+	for _, set := range []bool{
+		o.Width > 0 || o.Height > 0,
+		len(o.Sizes) > 0,
+		o.Scale > 0,
+		o.MaxSize > 0,
+		o.MinSize > 0,
+	} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// withDefaults returns a copy of the options with zero values filled in.
+func (o Options) withDefaults() Options {
+	if o.Quality == 0 {
+		o.Quality = DefaultQuality
+	}
+	// Mode and Anchor were checked by validate, so parsing only normalizes case
+	switch {
+	case o.Mode != "":
+		o.Mode, _ = ParseMode(string(o.Mode))
+	case o.KeepRatio:
+		o.Mode = ModeFit
+	default:
+		o.Mode = ModeStretch
+	}
+	if o.Filter != "" {
+		o.Filter, _ = ParseFilter(string(o.Filter))
+	} else {
+		o.Filter = FilterLanczos
+	}
+	if o.Format != "" {
+		o.Format, _ = ParseFormat(string(o.Format))
+	}
+	if o.Metadata != "" {
+		o.Metadata, _ = ParseMetadataMode(string(o.Metadata))
+	} else {
+		o.Metadata = MetadataStrip
+	}
+	if o.Anchor != "" {
+		o.Anchor, _ = ParseAnchor(string(o.Anchor))
+	} else {
+		o.Anchor = AnchorCenter
+	}
+	return o
+}
@@ -0,0 +1,160 @@
+package resize
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+)
+
+// header is what probe learns about an image file without decoding its pixels.
+type header struct {
+	width  int // Width after applying the EXIF orientation (unless NoAutoOrient)
+	height int // Height after applying the EXIF orientation (unless NoAutoOrient)
+	format Format
+	size   int64 // File size in bytes
+}
+
+/*
+probe reads only as much of the image at path as image.DecodeConfig needs to
+report its format and dimensions. For JPEGs the EXIF orientation, which is
+stored in front of the frame header, is applied the same way decode does.
+*/
+func (r *Resizer) probe(path string) (header, error) {
+	f, err := os.Open(path) // #nosec G304 -- reading user-specified input is the purpose of the tool
+	if err != nil {
+		return header{}, fmt.Errorf("failed to open image %s: %v", path, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return header{}, fmt.Errorf("failed to open image %s: %v", path, err)
+	}
+
+	// Keep the bytes DecodeConfig consumed to look for the EXIF orientation
+	var consumed bytes.Buffer
+	cfg, name, err := image.DecodeConfig(bufio.NewReader(io.TeeReader(f, &consumed)))
+	if err != nil {
+		return header{}, fmt.Errorf("failed to open image %s: %v", path, err)
+	}
+	format, err := ParseFormat(name)
+	if err != nil {
+		return header{}, fmt.Errorf("failed to open image %s: %v", path, err)
+	}
+
+	h := header{width: cfg.Width, height: cfg.Height, format: format, size: info.Size()}
+	if format == FormatJPEG && !r.opts.NoAutoOrient {
+		// Orientations 5-8 rotate by 90 degrees and swap the dimensions
+		if exifOrientation(readJPEGMetadata(consumed.Bytes()).exif) >= 5 {
+			h.width, h.height = h.height, h.width
+		}
+	}
+	return h, nil
+}
+
+/*
+Plan reports what ResizeFileVariants would do for inputPath without decoding
+any pixels or writing anything: one Result per Sizes entry (or one for Width
+and Height) with the dimensions, output and backup paths and format filled
+in. Only the image header is read, so OutputSize stays zero. Sizes left alone
+by a guard option are skipped the same way, including returning
+ErrWithinBounds.
+*/
+func (r *Resizer) Plan(inputPath string) ([]*Result, error) {
+	h, err := r.probe(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.opts.checkInputSize(h.size); err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %w", inputPath, err)
+	}
+	if err := r.opts.checkPixels(h.width, h.height); err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %w", inputPath, err)
+	}
+
+	variants := []*Resizer{r}
+	if len(r.opts.Sizes) > 0 {
+		variants = variants[:0]
+		for _, size := range r.opts.Sizes {
+			opts := r.opts
+			opts.Width, opts.Height, opts.Sizes = size.Width, size.Height, nil
+			variants = append(variants, &Resizer{opts: opts})
+		}
+	}
+
+	results := make([]*Result, 0, len(variants))
+	for _, v := range variants {
+		if v.withinBounds(h.width, h.height) {
+			continue
+		}
+		result := &Result{
+			InputPath:      inputPath,
+			OriginalWidth:  h.width,
+			OriginalHeight: h.height,
+			InputSize:      h.size,
+		}
+		result.TargetWidth, result.TargetHeight = v.TargetSize(h.width, h.height)
+		result.Width, result.Height = v.outputSize(
+			h.width, h.height, result.TargetWidth, result.TargetHeight,
+		)
+		result.OutputPath = v.opts.outputPath(inputPath, nameData{
+			width:      result.Width,
+			height:     result.Height,
+			origWidth:  h.width,
+			origHeight: h.height,
+			format:     h.format,
+		})
+		if err := v.opts.checkOutputPath(inputPath, result.OutputPath); err != nil {
+			return nil, err
+		}
+		result.BackupPath = v.opts.BackupPath(result.OutputPath)
+		result.InputFormat = h.format
+		if result.Format = v.opts.Format; result.Format == "" {
+			result.Format = h.format
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil, ErrWithinBounds
+	}
+	return results, nil
+}
+
+/*
+outputSize returns the dimensions scale produces for a source of the given
+size without touching any pixels. It mirrors the rounding of the imaging
+functions scale calls.
+*/
+func (r *Resizer) outputSize(srcWidth, srcHeight, targetWidth, targetHeight int) (int, int) {
+	switch {
+	case r.opts.Width > 0 && r.opts.Height == 0:
+		return targetWidth, scaleRounded(targetWidth, srcHeight, srcWidth)
+	case r.opts.Width == 0 && r.opts.Height > 0:
+		return scaleRounded(targetHeight, srcWidth, srcHeight), targetHeight
+	case r.opts.Width == 0 && r.opts.Height == 0:
+		// Scale, MaxSize and MinSize produce their target exactly
+		return targetWidth, targetHeight
+	case r.opts.Mode == ModeFit:
+		// imaging.Fit leaves images that already fit unchanged
+		if srcWidth <= targetWidth && srcHeight <= targetHeight {
+			return srcWidth, srcHeight
+		}
+		srcRatio := float64(srcWidth) / float64(srcHeight)
+		if srcRatio > float64(targetWidth)/float64(targetHeight) {
+			return targetWidth, max(1, int(float64(targetWidth)/srcRatio))
+		}
+		return max(1, int(float64(targetHeight)*srcRatio)), targetHeight
+	default:
+		// Stretch, and fill and pad, which always produce the exact box
+		return targetWidth, targetHeight
+	}
+}
+
+// scaleRounded scales other by size/along, rounded as imaging.Resize does.
+func scaleRounded(size, other, along int) int {
+	return int(math.Max(1, math.Floor(float64(size)*float64(other)/float64(along)+0.5)))
+}
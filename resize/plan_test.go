@@ -0,0 +1,120 @@
+package resize
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanMatchesResize(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo.png")
+	// Odd dimensions exercise the rounding of every mode
+	writeTestPNG(t, input, 337, 211)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"width only", Options{Width: 100}},
+		{"height only", Options{Height: 77}},
+		{"stretch", Options{Width: 100, Height: 100}},
+		{"fit", Options{Width: 100, Height: 100, Mode: ModeFit}},
+		{"fit tall box", Options{Width: 90, Height: 200, Mode: ModeFit}},
+		{"fit already within", Options{Width: 500, Height: 500, Mode: ModeFit}},
+		{"fill", Options{Width: 64, Height: 64, Mode: ModeFill}},
+		{"pad", Options{Width: 64, Height: 80, Mode: ModePad}},
+		{"sizes", Options{Sizes: []Size{{Width: 320}, {Width: 101}, {Height: 33}}}},
+		{"format", Options{Width: 50, Format: FormatWebP}},
+		{"scale", Options{Scale: 0.33}},
+		{"scale up with keep ratio", Options{Scale: 1.5, KeepRatio: true}},
+		{"max size", Options{MaxSize: 97}},
+		{"min size", Options{MinSize: 97}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.OutputDir = filepath.Join(dir, tt.name)
+			r, err := New(opts)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			planned, err := r.Plan(input)
+			if err != nil {
+				t.Fatalf("Plan() error = %v", err)
+			}
+			if _, err := os.Stat(opts.OutputDir); !os.IsNotExist(err) {
+				t.Errorf("Plan() must not write anything, stat error = %v", err)
+			}
+
+			results, err := r.ResizeFileVariants(context.Background(), input)
+			if err != nil {
+				t.Fatalf("ResizeFileVariants() error = %v", err)
+			}
+			if len(planned) != len(results) {
+				t.Fatalf("Plan() returned %d results, want %d", len(planned), len(results))
+			}
+			for i, want := range results {
+				got := planned[i]
+				if got.Width != want.Width || got.Height != want.Height ||
+					got.OutputPath != want.OutputPath || got.Format != want.Format ||
+					got.InputSize != want.InputSize {
+					t.Errorf("Plan()[%d] = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanAppliesOrientation(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "portrait.jpg")
+	// Stored landscape, displayed portrait (orientation 6 rotates 90 degrees)
+	if err := os.WriteFile(input, jpegWithOrientation(t, 80, 40, 6), 0o600); err != nil {
+		t.Fatalf("Failed to write JPEG: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		noAutoOrient bool
+		wantWidth    int
+		wantHeight   int
+	}{
+		{"auto orient", false, 20, 40},
+		{"no auto orient", true, 20, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(Options{Width: 20, NoAutoOrient: tt.noAutoOrient})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			planned, err := r.Plan(input)
+			if err != nil {
+				t.Fatalf("Plan() error = %v", err)
+			}
+			if planned[0].Width != tt.wantWidth || planned[0].Height != tt.wantHeight {
+				t.Errorf("Plan() size = %dx%d, want %dx%d",
+					planned[0].Width, planned[0].Height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func TestPlanRejectsNonImage(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "broken.png")
+	if err := os.WriteFile(input, []byte("not an image"), 0o600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	r, err := New(Options{Width: 20})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := r.Plan(input); err == nil {
+		t.Error("Plan() expected an error for a non-image file")
+	}
+}
@@ -0,0 +1,425 @@
+/*
+Package resize implements the image resizing engine behind resize-tool.
+
+A Resizer is built from an explicit Options value and can scale images read
+from any io.Reader or directly from files on disk. It never prints anything;
+callers receive a Result describing what was done and decide how to report it.
+*/
+package resize
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+	xwebp "golang.org/x/image/webp"
+	"golang.org/x/sync/semaphore"
+)
+
+// Result describes a completed resize.
+type Result struct {
+	InputPath      string // Source file (empty for stream resizes)
+	OutputPath     string // Written file (empty for stream resizes)
+	Format         Format // Encoded image format
+	InputFormat    Format // Format detected from the input content
+	OriginalWidth  int    // Width of the decoded source image
+	OriginalHeight int    // Height of the decoded source image
+	TargetWidth    int    // Width requested by the options
+	TargetHeight   int    // Height requested by the options
+	Width          int    // Actual width of the output image
+	Height         int    // Actual height of the output image
+	InputSize      int64  // Source size in bytes
+	OutputSize     int64  // Encoded output size in bytes
+	BackupPath     string // Copy of the replaced file kept by the Backup option
+}
+
+// Resizer scales images according to a fixed set of Options.
+// It is safe for concurrent use by multiple goroutines.
+type Resizer struct {
+	opts   Options
+	budget *semaphore.Weighted // Shared MemoryBudget (nil = no limit)
+}
+
+// New validates opts and returns a Resizer that applies them.
+func New(opts Options) (*Resizer, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	r := &Resizer{opts: opts.withDefaults()}
+	if opts.MemoryBudget > 0 {
+		r.budget = semaphore.NewWeighted(opts.MemoryBudget)
+	}
+	return r, nil
+}
+
+// Options returns the options the Resizer was built with (defaults applied).
+func (r *Resizer) Options() Options {
+	return r.opts
+}
+
+// requireSize reports an error if no single target size is configured.
+func (r *Resizer) requireSize() error {
+	if len(r.opts.Sizes) > 0 {
+		return errors.New("no single size set; use ResizeFileVariants for Sizes")
+	}
+	return nil
+}
+
+/*
+Resize decodes an image from in, scales it and encodes the result to out
+using the Format option, or the same format as the input if it is unset.
+It returns ErrWithinBounds without writing anything if a guard option
+leaves the image alone.
+*/
+func (r *Resizer) Resize(ctx context.Context, in io.Reader, out io.Writer) (*Result, error) {
+	if err := r.requireSize(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Read one byte past MaxInputBytes to tell whether the input exceeds it
+	if r.opts.MaxInputBytes > 0 {
+		in = io.LimitReader(in, r.opts.MaxInputBytes+1)
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image: %v", err)
+	}
+	if err := r.opts.checkInputSize(int64(len(data))); err != nil {
+		return nil, err
+	}
+
+	release, err := r.admit(ctx, data)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	defer release()
+
+	src, inputFormat, err := r.decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	if bounds := src.Bounds(); r.withinBounds(bounds.Dx(), bounds.Dy()) {
+		return nil, ErrWithinBounds
+	}
+	format := inputFormat
+	if r.opts.Format != "" {
+		format = r.opts.Format
+	}
+
+	result := r.newResult(src)
+	result.InputFormat = inputFormat
+	result.InputSize = int64(len(data))
+	resized := r.scale(src, result)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	encoded, err := r.encode(resized, format, r.readMetadata(data, inputFormat), result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %v", err)
+	}
+	if _, err := out.Write(encoded); err != nil {
+		return nil, fmt.Errorf("failed to write image: %v", err)
+	}
+	result.Format = format
+	result.OutputSize = int64(len(encoded))
+
+	return result, nil
+}
+
+/*
+ResizeFile resizes the image at inputPath and writes it to outputPath. An empty
+outputPath is derived from the options with OutputPath once the final
+dimensions are known. The output format is the Format option; if it is unset,
+it follows the extension of an explicit outputPath, or is the input format
+detected from the content for a derived one. It returns ErrWithinBounds
+without writing anything if a guard option leaves the image alone.
+*/
+func (r *Resizer) ResizeFile(ctx context.Context, inputPath, outputPath string) (*Result, error) {
+	if err := r.requireSize(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	src, err := r.load(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.release()
+	if bounds := src.img.Bounds(); r.withinBounds(bounds.Dx(), bounds.Dy()) {
+		return nil, ErrWithinBounds
+	}
+
+	result, _, err := r.writeFile(ctx, src, src.img, outputPath)
+	return result, err
+}
+
+/*
+source is a decoded input file together with its encoded bytes. release
+returns its share of the MemoryBudget once the image is no longer needed.
+*/
+type source struct {
+	path    string
+	data    []byte
+	img     image.Image
+	format  Format
+	release func()
+}
+
+/*
+load reads and decodes the image file at path. The file size and the
+dimensions declared in its header are checked against the safety limits, and
+the memory budget is reserved, before any pixels are decoded.
+*/
+func (r *Resizer) load(ctx context.Context, path string) (*source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %v", path, err)
+	}
+	if err := r.opts.checkInputSize(info.Size()); err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %w", path, err)
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304 -- reading user-specified input is the purpose of the tool
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %v", path, err)
+	}
+
+	release, err := r.admit(ctx, data)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("failed to open image %s: %w", path, err)
+	}
+
+	img, format, err := r.decode(data)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to open image %s: %v", path, err)
+	}
+
+	return &source{path: path, data: data, img: img, format: format, release: release}, nil
+}
+
+/*
+writeFile scales base (src.img or an already downscaled copy of it) to the
+options' target size, encodes it and atomically writes it to outputPath,
+deriving the path when empty. It returns the result and the scaled image.
+*/
+func (r *Resizer) writeFile(
+	ctx context.Context,
+	src *source,
+	base image.Image,
+	outputPath string,
+) (*Result, image.Image, error) {
+	result := r.newResult(src.img)
+	result.InputPath = src.path
+	result.InputFormat = src.format
+	result.InputSize = int64(len(src.data))
+	resized := r.scale(base, result)
+
+	format := r.opts.Format
+	if outputPath == "" {
+		outputPath = r.opts.outputPath(src.path, nameData{
+			width:      result.Width,
+			height:     result.Height,
+			origWidth:  result.OriginalWidth,
+			origHeight: result.OriginalHeight,
+			format:     src.format,
+			data:       src.data,
+		})
+		// Keep the format of the content, whatever the input file is called
+		if format == "" {
+			format = src.format
+		}
+	}
+	if err := r.opts.checkOutputPath(src.path, outputPath); err != nil {
+		return nil, nil, err
+	}
+	if format == "" {
+		var err error
+		if format, err = FormatFromFilename(outputPath); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// Ensure output directory exists
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	encoded, err := r.encode(resized, format, r.readMetadata(src.data, src.format), result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to save image: %v", err)
+	}
+	// Keep the file about to be replaced (the original with Overwrite)
+	if result.BackupPath, err = r.backupFile(outputPath); err != nil {
+		return nil, nil, err
+	}
+	if err := writeAtomic(outputPath, encoded); err != nil {
+		return nil, nil, fmt.Errorf("failed to save image: %v", err)
+	}
+
+	result.OutputPath = outputPath
+	result.Format = format
+	result.OutputSize = int64(len(encoded))
+
+	return result, resized, nil
+}
+
+// TargetSize returns the dimensions the options request for an image of the given size.
+func (r *Resizer) TargetSize(originalWidth, originalHeight int) (int, int) {
+	return r.opts.TargetSize(originalWidth, originalHeight)
+}
+
+// OutputPath returns the path a resized copy of inputPath would be written to.
+func (r *Resizer) OutputPath(inputPath string, width, height int) string {
+	return r.opts.OutputPath(inputPath, width, height)
+}
+
+// newResult records the source and target dimensions for src.
+func (r *Resizer) newResult(src image.Image) *Result {
+	// Dx/Dy account for a non-zero bounds origin
+	bounds := src.Bounds()
+	result := &Result{
+		OriginalWidth:  bounds.Dx(),
+		OriginalHeight: bounds.Dy(),
+	}
+	result.TargetWidth, result.TargetHeight = r.TargetSize(
+		result.OriginalWidth,
+		result.OriginalHeight,
+	)
+	return result
+}
+
+/*
+scale resizes src to the target recorded in result and stores the actual
+output dimensions back into result.
+*/
+func (r *Resizer) scale(src image.Image, result *Result) image.Image {
+	targetWidth, targetHeight := result.TargetWidth, result.TargetHeight
+	filter := r.opts.Filter.resampleFilter()
+
+	var resized image.Image
+
+	// Choose resizing method based on which dimensions were set and the mode
+	switch {
+	case r.opts.Width > 0 && r.opts.Height == 0:
+		// Only width set, height is auto-calculated
+		resized = imaging.Resize(src, targetWidth, 0, filter)
+	case r.opts.Width == 0 && r.opts.Height > 0:
+		// Only height set, width is auto-calculated
+		resized = imaging.Resize(src, 0, targetHeight, filter)
+	case r.opts.Width == 0 && r.opts.Height == 0:
+		// Scale, MaxSize or MinSize: the target already keeps the aspect ratio
+		resized = imaging.Resize(src, targetWidth, targetHeight, filter)
+	case r.opts.Mode == ModeFit:
+		// Both set to positive values, keep ratio (fit within bounds)
+		resized = imaging.Fit(src, targetWidth, targetHeight, filter)
+	case r.opts.Mode == ModeFill:
+		// Scale to cover the box, then crop the overflow around the anchor
+		resized = imaging.Fill(
+			src,
+			targetWidth,
+			targetHeight,
+			r.opts.Anchor.imagingAnchor(),
+			filter,
+		)
+	case r.opts.Mode == ModePad:
+		// Fit within the box, then center (or anchor) it on a background canvas
+		fitted := imaging.Fit(src, targetWidth, targetHeight, filter)
+		canvas := imaging.New(targetWidth, targetHeight, r.opts.Background)
+		pos := r.opts.Anchor.position(canvas.Bounds().Size(), fitted.Bounds().Size())
+		resized = imaging.Paste(canvas, fitted, pos)
+	default:
+		// Force resize to the given dimensions (may distort)
+		resized = imaging.Resize(src, targetWidth, targetHeight, filter)
+	}
+
+	bounds := resized.Bounds()
+	result.Width = bounds.Dx()
+	result.Height = bounds.Dy()
+
+	return resized
+}
+
+/*
+encode encodes img in the given format, flattening transparency the format
+cannot store, and carries the source metadata over as configured by the
+Metadata option. The orientation tag is only reset when decode actually
+rotated the pixels, which it does for JPEG input alone.
+*/
+func (r *Resizer) encode(
+	img image.Image,
+	format Format,
+	src metadata,
+	result *Result,
+) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := r.encodeImage(&buf, r.flatten(img, format), format); err != nil {
+		return nil, err
+	}
+
+	oriented := !r.opts.NoAutoOrient && result.InputFormat == FormatJPEG
+	md := src.prepare(r.opts.Metadata, oriented, result.Width, result.Height)
+	return writeMetadata(buf.Bytes(), format, md), nil
+}
+
+// readMetadata extracts the source metadata unless it is going to be stripped anyway.
+func (r *Resizer) readMetadata(data []byte, format Format) metadata {
+	if r.opts.Metadata == MetadataStrip {
+		return metadata{}
+	}
+	return readMetadata(data, format)
+}
+
+/*
+decode decodes an encoded image and reports its format. Unless
+NoAutoOrient is set, the EXIF orientation tag is applied so that the returned
+image (and therefore every size computed from it) is upright.
+*/
+func (r *Resizer) decode(data []byte) (image.Image, Format, error) {
+	_, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	format, err := ParseFormat(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var img image.Image
+	if format == FormatWebP {
+		// Decode WebP with the pure Go decoder; orientation only applies to JPEG
+		img, err = xwebp.Decode(bytes.NewReader(data))
+	} else {
+		img, err = imaging.Decode(
+			bytes.NewReader(data),
+			imaging.AutoOrientation(!r.opts.NoAutoOrient),
+		)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return img, format, nil
+}
@@ -0,0 +1,445 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Helper function to create an in-memory test image
+func newTestImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			r := uint8((x * 255) / width)  // #nosec G115 - Safe conversion for test data
+			g := uint8((y * 255) / height) // #nosec G115 - Safe conversion for test data
+			img.Set(x, y, color.RGBA{r, g, 128, 255})
+		}
+	}
+	return img
+}
+
+// Helper function to write a PNG test image to disk
+func writeTestPNG(t *testing.T, path string, width, height int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create test image: %v", err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, newTestImage(width, height)); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+}
+
+// Helper function to decode the dimensions of an image file
+func decodeSize(t *testing.T, path string) (int, int) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("Failed to decode config of %s: %v", path, err)
+	}
+	return cfg.Width, cfg.Height
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"width only", Options{Width: 100}, false},
+		{"height only", Options{Height: 100}, false},
+		{"no dimensions", Options{}, true},
+		{"negative width", Options{Width: -1}, true},
+		{"quality too high", Options{Width: 100, Quality: 101}, true},
+		{"overwrite with output dir", Options{Width: 100, Overwrite: true, OutputDir: "out"}, true},
+		{"scale only", Options{Scale: 0.5}, false},
+		{"max size only", Options{MaxSize: 100}, false},
+		{"min size only", Options{MinSize: 100}, false},
+		{"negative scale", Options{Scale: -0.5}, true},
+		{"scale with width", Options{Width: 100, Scale: 0.5}, true},
+		{"max size with min size", Options{MaxSize: 100, MinSize: 50}, true},
+		{"max size with sizes", Options{MaxSize: 100, Sizes: []Size{{Width: 50}}}, true},
+		{"negative max pixels", Options{Width: 100, MaxPixels: -1}, true},
+		{"negative memory budget", Options{Width: 100, MemoryBudget: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewAppliesDefaults(t *testing.T) {
+	r, err := New(Options{Width: 100})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if got := r.Options().Quality; got != DefaultQuality {
+		t.Errorf("Quality = %d, want %d", got, DefaultQuality)
+	}
+}
+
+func TestOptionsTargetSize(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           Options
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{"both set", Options{Width: 400, Height: 300}, 400, 300},
+		{"width only", Options{Width: 400}, 400, 300},
+		{"height only", Options{Height: 300}, 400, 300},
+		{"scale down", Options{Scale: 0.5}, 400, 300},
+		{"scale up", Options{Scale: 1.25}, 1000, 750},
+		{"max size", Options{MaxSize: 200}, 200, 150},
+		{"min size", Options{MinSize: 300}, 400, 300},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotWidth, gotHeight := tt.opts.TargetSize(800, 600)
+			if gotWidth != tt.expectedWidth || gotHeight != tt.expectedHeight {
+				t.Errorf("TargetSize() = (%d, %d), want (%d, %d)",
+					gotWidth, gotHeight, tt.expectedWidth, tt.expectedHeight)
+			}
+		})
+	}
+}
+
+func TestOptionsTargetSizeOrientation(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           Options
+		originalWidth  int
+		originalHeight int
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{"max size landscape", Options{MaxSize: 2048}, 4000, 3000, 2048, 1536},
+		{"max size portrait", Options{MaxSize: 2048}, 3000, 4000, 1536, 2048},
+		{"max size square", Options{MaxSize: 100}, 500, 500, 100, 100},
+		{"min size landscape", Options{MinSize: 300}, 4000, 3000, 400, 300},
+		{"min size portrait", Options{MinSize: 300}, 3000, 4000, 300, 400},
+		{"scale rounds", Options{Scale: 0.5}, 101, 51, 51, 26},
+		{"scale keeps one pixel", Options{Scale: 0.01}, 10, 10, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotWidth, gotHeight := tt.opts.TargetSize(tt.originalWidth, tt.originalHeight)
+			if gotWidth != tt.expectedWidth || gotHeight != tt.expectedHeight {
+				t.Errorf("TargetSize() = (%d, %d), want (%d, %d)",
+					gotWidth, gotHeight, tt.expectedWidth, tt.expectedHeight)
+			}
+		})
+	}
+}
+
+func TestParseScale(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{"50%", 0.5, false},
+		{"50", 0.5, false},
+		{" 150% ", 1.5, false},
+		{"12.5%", 0.125, false},
+		{"0%", 0, true},
+		{"-50%", 0, true},
+		{"half", 0, true},
+		{"NaN", 0, true},
+		{"Inf%", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseScale(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScale(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseScale(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResize(t *testing.T) {
+	var in bytes.Buffer
+	if err := png.Encode(&in, newTestImage(400, 300)); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+
+	r, err := New(Options{Width: 200})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	var out bytes.Buffer
+	result, err := r.Resize(context.Background(), &in, &out)
+	if err != nil {
+		t.Fatalf("Resize() returned error: %v", err)
+	}
+
+	if result.Width != 200 || result.Height != 150 {
+		t.Errorf("Resize() size = %dx%d, want 200x150", result.Width, result.Height)
+	}
+	if result.Format != FormatPNG {
+		t.Errorf("Resize() format = %q, want %q", result.Format, FormatPNG)
+	}
+	if result.OutputSize != int64(out.Len()) {
+		t.Errorf("Resize() OutputSize = %d, want %d", result.OutputSize, out.Len())
+	}
+
+	cfg, format, err := image.DecodeConfig(&out)
+	if err != nil {
+		t.Fatalf("Failed to decode output: %v", err)
+	}
+	if format != "png" || cfg.Width != 200 || cfg.Height != 150 {
+		t.Errorf("output = %s %dx%d, want png 200x150", format, cfg.Width, cfg.Height)
+	}
+}
+
+func TestResizeCanceled(t *testing.T) {
+	r, err := New(Options{Width: 200})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = r.Resize(ctx, bytes.NewReader(nil), &bytes.Buffer{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Resize() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestResizeFile(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "photo.png")
+	writeTestPNG(t, inputPath, 400, 300)
+
+	tests := []struct {
+		name           string
+		opts           Options
+		outputPath     string
+		expectedPath   string
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{
+			name:           "derived output path",
+			opts:           Options{Width: 200},
+			expectedPath:   filepath.Join(tempDir, "photo_200x150.png"),
+			expectedWidth:  200,
+			expectedHeight: 150,
+		},
+		{
+			name:           "output directory",
+			opts:           Options{Height: 150, OutputDir: filepath.Join(tempDir, "out")},
+			expectedPath:   filepath.Join(tempDir, "out", "photo_200x150.png"),
+			expectedWidth:  200,
+			expectedHeight: 150,
+		},
+		{
+			name:           "keep ratio fits within bounds",
+			opts:           Options{Width: 100, Height: 100, KeepRatio: true},
+			expectedPath:   filepath.Join(tempDir, "photo_100x75.png"),
+			expectedWidth:  100,
+			expectedHeight: 75,
+		},
+		{
+			name:           "max size",
+			opts:           Options{MaxSize: 120},
+			expectedPath:   filepath.Join(tempDir, "photo_120x90.png"),
+			expectedWidth:  120,
+			expectedHeight: 90,
+		},
+		{
+			name:           "scale up with keep ratio",
+			opts:           Options{Scale: 1.5, KeepRatio: true},
+			expectedPath:   filepath.Join(tempDir, "photo_600x450.png"),
+			expectedWidth:  600,
+			expectedHeight: 450,
+		},
+		{
+			name:           "explicit output path",
+			opts:           Options{Width: 50, Height: 50},
+			outputPath:     filepath.Join(tempDir, "explicit.png"),
+			expectedPath:   filepath.Join(tempDir, "explicit.png"),
+			expectedWidth:  50,
+			expectedHeight: 50,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(tt.opts)
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+
+			result, err := r.ResizeFile(context.Background(), inputPath, tt.outputPath)
+			if err != nil {
+				t.Fatalf("ResizeFile() returned error: %v", err)
+			}
+
+			if result.OutputPath != tt.expectedPath {
+				t.Errorf("OutputPath = %q, want %q", result.OutputPath, tt.expectedPath)
+			}
+			if result.OriginalWidth != 400 || result.OriginalHeight != 300 {
+				t.Errorf("original size = %dx%d, want 400x300",
+					result.OriginalWidth, result.OriginalHeight)
+			}
+			gotWidth, gotHeight := decodeSize(t, result.OutputPath)
+			if gotWidth != tt.expectedWidth || gotHeight != tt.expectedHeight {
+				t.Errorf("output size = %dx%d, want %dx%d",
+					gotWidth, gotHeight, tt.expectedWidth, tt.expectedHeight)
+			}
+			if result.InputSize <= 0 || result.OutputSize <= 0 {
+				t.Errorf("expected byte sizes to be recorded, got %d -> %d",
+					result.InputSize, result.OutputSize)
+			}
+		})
+	}
+}
+
+// Helper function to encode a JPEG carrying an EXIF orientation tag
+func jpegWithOrientation(t *testing.T, width, height int, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, newTestImage(width, height), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+
+	// Big-endian TIFF header followed by a single-entry IFD0 holding the
+	// orientation tag (0x0112, SHORT, count 1).
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	exif = append(exif, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01)
+	exif = binary.BigEndian.AppendUint16(exif, orientation)
+	exif = append(exif, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+
+	segment := []byte{0xff, 0xe1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(exif)+2)) // #nosec G115
+	segment = append(segment, exif...)
+
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...) // SOI
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func TestResizeAutoOrient(t *testing.T) {
+	// Orientation 6 means the stored 40x20 pixels must be rotated 90° to be upright.
+	data := jpegWithOrientation(t, 40, 20, 6)
+
+	tests := []struct {
+		name           string
+		noAutoOrient   bool
+		originalWidth  int
+		originalHeight int
+		expectedHeight int
+	}{
+		{"auto orient by default", false, 20, 40, 20},
+		{"auto orient disabled", true, 40, 20, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(Options{Width: 10, NoAutoOrient: tt.noAutoOrient})
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+
+			result, err := r.Resize(context.Background(), bytes.NewReader(data), io.Discard)
+			if err != nil {
+				t.Fatalf("Resize() returned error: %v", err)
+			}
+			if result.OriginalWidth != tt.originalWidth ||
+				result.OriginalHeight != tt.originalHeight {
+				t.Errorf("original size = %dx%d, want %dx%d",
+					result.OriginalWidth, result.OriginalHeight,
+					tt.originalWidth, tt.originalHeight)
+			}
+			if result.Width != 10 || result.Height != tt.expectedHeight {
+				t.Errorf("output size = %dx%d, want 10x%d",
+					result.Width, result.Height, tt.expectedHeight)
+			}
+		})
+	}
+}
+
+func TestOptionsOutputPathInputRoot(t *testing.T) {
+	root := filepath.Join("photos", "2024")
+	tests := []struct {
+		name     string
+		opts     Options
+		input    string
+		expected string
+	}{
+		{
+			"mirrors subdirectories",
+			Options{OutputDir: "out", InputRoot: root},
+			filepath.Join(root, "a", "b", "logo.png"),
+			filepath.Join("out", "a", "b", "logo_10x10.png"),
+		},
+		{
+			"file directly in root",
+			Options{OutputDir: "out", InputRoot: root},
+			filepath.Join(root, "logo.png"),
+			filepath.Join("out", "logo_10x10.png"),
+		},
+		{
+			"file outside root",
+			Options{OutputDir: "out", InputRoot: root},
+			filepath.Join("other", "logo.png"),
+			filepath.Join("out", "logo_10x10.png"),
+		},
+		{
+			"no root keeps the flat layout",
+			Options{OutputDir: "out"},
+			filepath.Join(root, "a", "logo.png"),
+			filepath.Join("out", "logo_10x10.png"),
+		},
+		{
+			"no output directory ignores root",
+			Options{InputRoot: root},
+			filepath.Join(root, "a", "logo.png"),
+			filepath.Join(root, "a", "logo_10x10.png"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.OutputPath(tt.input, 10, 10); got != tt.expected {
+				t.Errorf("OutputPath() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package resize
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+TargetSize computes the target width and height for an image of the given
+size, preserving the aspect ratio if only one dimension is set or the size
+is given by Scale, MaxSize or MinSize.
+*/
+func (o Options) TargetSize(originalWidth, originalHeight int) (int, int) {
+	landscape := originalWidth >= originalHeight
+	switch {
+	case o.Scale > 0:
+		return max(1, int(math.Round(float64(originalWidth)*o.Scale))),
+			max(1, int(math.Round(float64(originalHeight)*o.Scale)))
+	case o.MaxSize > 0 && landscape, o.MinSize > 0 && !landscape:
+		// The width is the edge being set
+		edge := max(o.MaxSize, o.MinSize)
+		return edge, scaleRounded(edge, originalHeight, originalWidth)
+	case o.MaxSize > 0, o.MinSize > 0:
+		// The height is the edge being set
+		edge := max(o.MaxSize, o.MinSize)
+		return scaleRounded(edge, originalWidth, originalHeight), edge
+	case o.Width > 0 && o.Height > 0:
+		// Both dimensions are explicitly set, use them directly
+		return o.Width, o.Height
+	case o.Width > 0:
+		// Only width is set, calculate height proportionally
+		ratio := float64(originalHeight) / float64(originalWidth)
+		return o.Width, int(float64(o.Width) * ratio)
+	case o.Height > 0:
+		// Only height is set, calculate width proportionally
+		ratio := float64(originalWidth) / float64(originalHeight)
+		return int(float64(o.Height) * ratio), o.Height
+	default:
+		// Rejected by validate; returned unchanged for zero Options
+		return o.Width, o.Height
+	}
+}
+
+/*
+ParseScale parses a percentage such as "50%" (or "50") into the factor used
+by Options.Scale.
+*/
+func ParseScale(s string) (float64, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil || percent <= 0 || math.IsInf(percent, 0) || math.IsNaN(percent) {
+		return 0, errors.New("invalid scale " + strconv.Quote(s) + " (use a percentage such as 50%)")
+	}
+	return percent / 100, nil
+}
+
+/*
+OutputPath creates the output file path for a resized image, named by
+NameTemplate (by default including the new dimensions) and using OutputDir
+(mirroring the directory tree below InputRoot) if provided. If Overwrite
+is set, it returns the original file path (ignoring OutputDir). When Format
+is set, the extension is replaced with the one for that format. The source
+dimensions are not known here, so {origW} and {origH} expand to 0.
+*/
+func (o Options) OutputPath(inputPath string, width, height int) string {
+	return o.outputPath(inputPath, nameData{width: width, height: height})
+}
+
+// outputPath is OutputPath with all the values the name template can use.
+func (o Options) outputPath(inputPath string, d nameData) string {
+	filename := filepath.Base(inputPath)
+	ext := filepath.Ext(filename)
+	nameWithoutExt := strings.TrimSuffix(filename, ext)
+	converted := o.Format != "" && !o.Format.matches(ext)
+	if converted {
+		ext = o.Format.Ext()
+	} else if o.FixExtension && o.Format == "" && ExtensionMismatch(inputPath, d.format) {
+		ext, converted = d.format.Ext(), true
+	}
+
+	// If overwrite mode is enabled, always return original file path
+	// (with the new extension when converting to another format or fixing it)
+	if o.Overwrite {
+		if converted {
+			return filepath.Join(filepath.Dir(inputPath), nameWithoutExt+ext)
+		}
+		return inputPath
+	}
+
+	dir := filepath.Dir(inputPath)
+	if o.OutputDir != "" {
+		dir = filepath.Join(o.OutputDir, o.relativeDir(inputPath))
+	}
+
+	return filepath.Join(dir, o.expandName(inputPath, nameWithoutExt, ext, d))
+}
+
+// relativeDir returns the directory of inputPath relative to InputRoot, or "" if it is not below it.
+func (o Options) relativeDir(inputPath string) string {
+	if o.InputRoot == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(o.InputRoot, filepath.Dir(inputPath))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return rel
+}
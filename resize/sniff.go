@@ -0,0 +1,87 @@
+package resize
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// sniffLen is the number of leading bytes DetectFormat needs.
+const sniffLen = 12
+
+/*
+signatures maps the magic bytes at the start of a file to its format; a '?'
+matches any byte (none of the signatures contains a literal '?').
+*/
+var signatures = []struct {
+	magic  string
+	format Format
+}{
+	{"\xff\xd8\xff", FormatJPEG},
+	{"\x89PNG\r\n\x1a\n", FormatPNG},
+	{"GIF87a", FormatGIF},
+	{"GIF89a", FormatGIF},
+	{"II*\x00", FormatTIFF},
+	{"MM\x00*", FormatTIFF},
+	{"BM", FormatBMP},
+	{"RIFF????WEBP", FormatWebP}, // The RIFF chunk size comes before the form type
+}
+
+// errUnknownFormat is returned by DetectFormat for data of no supported format.
+var errUnknownFormat = errors.New("not a supported image format")
+
+/*
+DetectFormat identifies the image format of data from its magic bytes,
+regardless of any file name. Only the first bytes of the file are needed.
+*/
+func DetectFormat(data []byte) (Format, error) {
+	for _, sig := range signatures {
+		if hasMagic(data, sig.magic) {
+			return sig.format, nil
+		}
+	}
+	return "", errUnknownFormat
+}
+
+// hasMagic reports whether data starts with magic, where '?' matches any byte.
+func hasMagic(data []byte, magic string) bool {
+	if len(data) < len(magic) {
+		return false
+	}
+	for i := range len(magic) {
+		if magic[i] != '?' && data[i] != magic[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// DetectFileFormat identifies the image format of the file at path from its magic bytes.
+func DetectFileFormat(path string) (Format, error) {
+	f, err := os.Open(path) // #nosec G304 -- reading user-specified input is the purpose of the tool
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("%s: %v", path, errUnknownFormat)
+	}
+	format, err := DetectFormat(header[:n])
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	return format, nil
+}
+
+/*
+ExtensionMismatch reports whether the extension of path is missing or belongs
+to another format than detected, such as a PNG saved as photo.jpg.
+*/
+func ExtensionMismatch(path string, detected Format) bool {
+	return detected != "" && !detected.matches(filepath.Ext(path))
+}
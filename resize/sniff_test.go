@@ -0,0 +1,142 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestDetectFormat(t *testing.T) {
+	img := newTestImage(4, 3)
+	for _, format := range []Format{FormatJPEG, FormatPNG, FormatGIF, FormatTIFF, FormatBMP, FormatWebP} {
+		t.Run(string(format), func(t *testing.T) {
+			r, err := New(Options{Width: 4, Format: format})
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := r.encodeImage(&buf, img, format); err != nil {
+				t.Fatalf("encodeImage() returned error: %v", err)
+			}
+
+			got, err := DetectFormat(buf.Bytes()[:sniffLen])
+			if err != nil || got != format {
+				t.Errorf("DetectFormat() = %q, %v; want %q", got, err, format)
+			}
+		})
+	}
+
+	for _, data := range []string{"", "hello world!", "RIFF\x00\x00\x00\x00WAVE", "\xff\xd8"} {
+		if got, err := DetectFormat([]byte(data)); err == nil {
+			t.Errorf("DetectFormat(%q) = %q, want error", data, got)
+		}
+	}
+}
+
+func TestExtensionMismatch(t *testing.T) {
+	tests := []struct {
+		path     string
+		detected Format
+		want     bool
+	}{
+		{"photo.jpg", FormatJPEG, false},
+		{"photo.JPEG", FormatJPEG, false},
+		{"photo.jpg", FormatPNG, true},
+		{"upload", FormatPNG, true},
+		{"scan.tif", FormatTIFF, false},
+		{"photo.jpg", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := ExtensionMismatch(tt.path, tt.detected); got != tt.want {
+			t.Errorf("ExtensionMismatch(%q, %q) = %v, want %v", tt.path, tt.detected, got, tt.want)
+		}
+	}
+}
+
+func TestResizeFileDetectsFormat(t *testing.T) {
+	tests := []struct {
+		name         string
+		input        string
+		fixExtension bool
+		expectedName string
+	}{
+		{"PNG named .jpg", "photo.jpg", false, "photo_100x75.jpg"},
+		{"PNG named .jpg, fixed", "photo.jpg", true, "photo_100x75.png"},
+		{"no extension", "upload", false, "upload_100x75"},
+		{"no extension, fixed", "upload", true, "upload_100x75.png"},
+		{"correct extension, fixed", "photo.png", true, "photo_100x75.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			inputPath := filepath.Join(tempDir, tt.input)
+			writeTestPNG(t, inputPath, 400, 300)
+
+			r, err := New(Options{Width: 100, FixExtension: tt.fixExtension})
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+			result, err := r.ResizeFile(context.Background(), inputPath, "")
+			if err != nil {
+				t.Fatalf("ResizeFile() returned error: %v", err)
+			}
+
+			if want := filepath.Join(tempDir, tt.expectedName); result.OutputPath != want {
+				t.Errorf("OutputPath = %q, want %q", result.OutputPath, want)
+			}
+			if result.InputFormat != FormatPNG || result.Format != FormatPNG {
+				t.Errorf("InputFormat, Format = %q, %q, want png for both", result.InputFormat, result.Format)
+			}
+			// The content keeps the input format whatever the name
+			f, err := os.Open(result.OutputPath)
+			if err != nil {
+				t.Fatalf("Failed to open output: %v", err)
+			}
+			defer f.Close()
+			if _, name, err := image.DecodeConfig(f); err != nil || name != "png" {
+				t.Errorf("output decodes as %q, %v; want png", name, err)
+			}
+
+			planned, err := r.Plan(inputPath)
+			if err != nil {
+				t.Fatalf("Plan() returned error: %v", err)
+			}
+			if planned[0].OutputPath != result.OutputPath || planned[0].Format != result.Format {
+				t.Errorf("Plan() = %s (%s), want %s (%s)",
+					planned[0].OutputPath, planned[0].Format, result.OutputPath, result.Format)
+			}
+		})
+	}
+}
+
+func TestDetectFileFormat(t *testing.T) {
+	tempDir := t.TempDir()
+	gifPath := filepath.Join(tempDir, "image.png")
+	if err := imaging.Save(newTestImage(2, 2), gifPath+".gif"); err != nil {
+		t.Fatalf("Failed to save test image: %v", err)
+	}
+	if err := os.Rename(gifPath+".gif", gifPath); err != nil {
+		t.Fatalf("Failed to rename test image: %v", err)
+	}
+	textPath := filepath.Join(tempDir, "notes")
+	if err := os.WriteFile(textPath, []byte("hi"), 0o644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	if got, err := DetectFileFormat(gifPath); err != nil || got != FormatGIF {
+		t.Errorf("DetectFileFormat(gif named .png) = %q, %v; want gif", got, err)
+	}
+	if got, err := DetectFileFormat(textPath); err == nil {
+		t.Errorf("DetectFileFormat(text) = %q, want error", got)
+	}
+	if _, err := DetectFileFormat(filepath.Join(tempDir, "missing")); err == nil {
+		t.Error("DetectFileFormat(missing file): expected error")
+	}
+}
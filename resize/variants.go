@@ -0,0 +1,203 @@
+package resize
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Size is one requested output size. A zero dimension is derived from the other.
+type Size struct {
+	Width  int
+	Height int
+}
+
+// String formats the size the way ParseSizes accepts it: "640", "1280x720" or "x480".
+func (s Size) String() string {
+	switch {
+	case s.Height == 0:
+		return strconv.Itoa(s.Width)
+	case s.Width == 0:
+		return "x" + strconv.Itoa(s.Height)
+	default:
+		return fmt.Sprintf("%dx%d", s.Width, s.Height)
+	}
+}
+
+/*
+ParseSizes parses a comma-separated size list such as "320,640,1280x720,x480".
+A bare number is a width, "WxH" sets both dimensions and "xH" only the height.
+*/
+func ParseSizes(s string) ([]Size, error) {
+	var sizes []Size
+	for field := range strings.SplitSeq(s, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+
+		w, h, hasHeight := strings.Cut(field, "x")
+		size, err := parseSize(w, h, hasHeight)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size %q: %v", field, err)
+		}
+		sizes = append(sizes, size)
+	}
+	if len(sizes) == 0 {
+		return nil, errors.New("no sizes specified")
+	}
+	return sizes, nil
+}
+
+// parseSize parses the width and optional height halves of a single size.
+func parseSize(w, h string, hasHeight bool) (Size, error) {
+	var size Size
+	var err error
+	if w != "" {
+		if size.Width, err = strconv.Atoi(w); err != nil {
+			return Size{}, errors.New("width is not a number")
+		}
+	}
+	if hasHeight {
+		if size.Height, err = strconv.Atoi(h); err != nil {
+			return Size{}, errors.New("height is not a number")
+		}
+	}
+	if size.Width < 0 || size.Height < 0 || size.Width == 0 && size.Height == 0 {
+		return Size{}, errors.New("dimensions must be positive")
+	}
+	return size, nil
+}
+
+/*
+ResizeFileVariants decodes the image at inputPath once and writes one output
+per entry in the Sizes option (or a single one for Width and Height when Sizes
+is empty), named with OutputPath. Results are returned in the order of Sizes.
+
+Variants are produced from largest to smallest, and each one is scaled from
+the smallest previously generated image that is still large enough instead of
+the full-size source, which makes long size lists much cheaper. If a variant
+fails or ctx is canceled, the variants already written are removed again.
+Sizes that a guard option (such as NoUpscale) leaves alone are left out of the
+results; if that applies to all of them, ErrWithinBounds is returned.
+*/
+func (r *Resizer) ResizeFileVariants(ctx context.Context, inputPath string) ([]*Result, error) {
+	if len(r.opts.Sizes) == 0 {
+		result, err := r.ResizeFile(ctx, inputPath, "")
+		if err != nil {
+			return nil, err
+		}
+		return []*Result{result}, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	src, err := r.load(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.release()
+
+	bounds := src.img.Bounds()
+	variants := make([]*Resizer, len(r.opts.Sizes))
+	scales := make([]float64, len(r.opts.Sizes))
+	for i, size := range r.opts.Sizes {
+		opts := r.opts
+		opts.Width, opts.Height, opts.Sizes = size.Width, size.Height, nil
+		variants[i] = &Resizer{opts: opts}
+		scales[i] = variants[i].sourceScale(bounds.Dx(), bounds.Dy())
+	}
+
+	// Process from the largest scale down so smaller variants can reuse larger ones
+	order := make([]int, len(variants))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(scales[b], scales[a])
+	})
+
+	results := make([]*Result, len(variants))
+	base := src.img
+	for _, i := range order {
+		if variants[i].withinBounds(bounds.Dx(), bounds.Dy()) {
+			continue
+		}
+		if !coversScale(base, bounds, scales[i]) {
+			base = src.img
+		}
+		result, resized, err := variants[i].writeFile(ctx, src, base, "")
+		if err != nil {
+			removeOutputs(results)
+			return nil, err
+		}
+		// Another size of different dimensions already wrote this file, which
+		// the name template cannot tell apart (the same dimensions twice are fine)
+		for j, other := range results {
+			if other != nil && other.OutputPath == result.OutputPath &&
+				(other.Width != result.Width || other.Height != result.Height) {
+				results[i] = result
+				removeOutputs(results)
+				return nil, fmt.Errorf("sizes %s and %s would both be written to %s",
+					r.opts.Sizes[j], r.opts.Sizes[i], result.OutputPath)
+			}
+		}
+		results[i] = result
+
+		// Only proportional scalings are faithful downscaled copies of the source
+		if variants[i].proportional() {
+			base = resized
+		}
+	}
+
+	// Sizes the guard options left alone produce no result
+	results = slices.DeleteFunc(results, func(r *Result) bool { return r == nil })
+	if len(results) == 0 {
+		return nil, ErrWithinBounds
+	}
+	return results, nil
+}
+
+/*
+sourceScale returns the factor the source must be scaled by before any crop,
+fit or stretch to produce this resizer's target size.
+*/
+func (r *Resizer) sourceScale(originalWidth, originalHeight int) float64 {
+	w, h := r.TargetSize(originalWidth, originalHeight)
+	return math.Max(
+		float64(w)/float64(originalWidth),
+		float64(h)/float64(originalHeight),
+	)
+}
+
+// proportional reports whether the resizer scales without cropping, padding or distorting.
+func (r *Resizer) proportional() bool {
+	return r.opts.Width == 0 || r.opts.Height == 0 || r.opts.Mode == ModeFit
+}
+
+// coversScale reports whether img is at least as large as the source scaled by scale.
+func coversScale(img image.Image, source image.Rectangle, scale float64) bool {
+	b := img.Bounds()
+	return b.Dx() >= int(math.Ceil(float64(source.Dx())*scale)) &&
+		b.Dy() >= int(math.Ceil(float64(source.Dy())*scale))
+}
+
+/*
+removeOutputs deletes the files written for results so far, so that a failed
+or canceled call does not leave an incomplete set of variants behind.
+*/
+func removeOutputs(results []*Result) {
+	for _, result := range results {
+		if result != nil && result.OutputPath != result.InputPath {
+			_ = os.Remove(result.OutputPath)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package resize
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSizes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Size
+		wantErr  bool
+	}{
+		{"320,640", []Size{{Width: 320}, {Width: 640}}, false},
+		{"1280x720, x480", []Size{{Width: 1280, Height: 720}, {Height: 480}}, false},
+		{"800X600,", []Size{{Width: 800, Height: 600}}, false},
+		{"", nil, true},
+		{"abc", nil, true},
+		{"0x0", nil, true},
+		{"-5", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSizes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSizes(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseSizes(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSizeString(t *testing.T) {
+	for _, size := range []Size{{Width: 320}, {Height: 480}, {Width: 1280, Height: 720}} {
+		parsed, err := ParseSizes(size.String())
+		if err != nil || len(parsed) != 1 || parsed[0] != size {
+			t.Errorf("ParseSizes(%q) = %v, %v; want round trip of %v", size, parsed, err, size)
+		}
+	}
+}
+
+func TestResizeFileVariants(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "hero.png")
+	writeTestPNG(t, inputPath, 800, 400)
+
+	r, err := New(Options{
+		Mode: ModeFill,
+		Sizes: []Size{
+			{Width: 100},
+			{Width: 400},
+			{Width: 200, Height: 200}, // fill: must not be derived from a 200x100 variant
+			{Height: 50},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	results, err := r.ResizeFileVariants(context.Background(), inputPath)
+	if err != nil {
+		t.Fatalf("ResizeFileVariants() returned error: %v", err)
+	}
+
+	expected := []struct {
+		name          string
+		width, height int
+	}{
+		{"hero_100x50.png", 100, 50},
+		{"hero_400x200.png", 400, 200},
+		{"hero_200x200.png", 200, 200},
+		{"hero_100x50.png", 100, 50},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("got %d results, want %d", len(results), len(expected))
+	}
+	for i, want := range expected {
+		result := results[i]
+		if result.OutputPath != filepath.Join(tempDir, want.name) {
+			t.Errorf("results[%d].OutputPath = %q, want %q", i, result.OutputPath, want.name)
+		}
+		if result.OriginalWidth != 800 || result.OriginalHeight != 400 {
+			t.Errorf("results[%d] original = %dx%d, want 800x400",
+				i, result.OriginalWidth, result.OriginalHeight)
+		}
+		w, h := decodeSize(t, result.OutputPath)
+		if w != want.width || h != want.height {
+			t.Errorf("%s size = %dx%d, want %dx%d", want.name, w, h, want.width, want.height)
+		}
+	}
+}
+
+func TestResizeFileVariantsWithoutSizes(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "single.png")
+	writeTestPNG(t, inputPath, 400, 300)
+
+	r, err := New(Options{Width: 200})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	results, err := r.ResizeFileVariants(context.Background(), inputPath)
+	if err != nil {
+		t.Fatalf("ResizeFileVariants() returned error: %v", err)
+	}
+	if len(results) != 1 || results[0].Width != 200 || results[0].Height != 150 {
+		t.Errorf("expected a single 200x150 result, got %+v", results)
+	}
+}
+
+func TestResizeFileVariantsSameOutput(t *testing.T) {
+	tempDir := t.TempDir()
+	inputPath := filepath.Join(tempDir, "photo.png")
+	writeTestPNG(t, inputPath, 90, 60)
+	outputDir := filepath.Join(tempDir, "out")
+
+	// x40 and 60x30 both come out 60 pixels wide, which is all the template names
+	opts := Options{
+		Sizes:        []Size{{Height: 40}, {Width: 60, Height: 30}},
+		NameTemplate: "{name}_{w}{ext}",
+		OutputDir:    outputDir,
+	}
+	r, err := New(opts)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	planned, err := r.Plan(inputPath)
+	if err != nil {
+		t.Fatalf("Plan() returned error: %v", err)
+	}
+	if len(planned) != 2 || planned[0].OutputPath != planned[1].OutputPath {
+		t.Fatalf("Plan() = %+v, want two results with the same output", planned)
+	}
+	if _, err := r.ResizeFileVariants(context.Background(), inputPath); err == nil {
+		t.Error("ResizeFileVariants() with two sizes on one output: expected error")
+	}
+	if entries, _ := os.ReadDir(outputDir); len(entries) != 0 {
+		t.Errorf("ResizeFileVariants() left %d files behind", len(entries))
+	}
+}
+
+func TestSizesValidation(t *testing.T) {
+	if _, err := New(Options{Sizes: []Size{{Width: 10}, {Width: 20}}, Overwrite: true}); err == nil {
+		t.Error("expected an error combining Overwrite with multiple sizes")
+	}
+	if _, err := New(Options{Sizes: []Size{{}}}); err == nil {
+		t.Error("expected an error for an empty size")
+	}
+
+	r, err := New(Options{Sizes: []Size{{Width: 10}}})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if _, err := r.ResizeFile(context.Background(), "unused.png", ""); err == nil {
+		t.Error("expected ResizeFile to require Width or Height")
+	}
+}
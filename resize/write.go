@@ -0,0 +1,150 @@
+package resize
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+writeAtomic writes data to path through a temporary file in the same
+directory that is renamed into place once it is complete. A crash or error
+mid-write therefore never leaves a truncated file at path, and an existing
+file (such as the original with Overwrite) is only replaced by a whole one.
+*/
+func writeAtomic(path string, data []byte) (err error) {
+	// Keep the permissions of a file being replaced; new files are meant to be
+	// as readable as their sources
+	perm := fs.FileMode(0o644)
+	if info, statErr := os.Stat(path); statErr == nil {
+		perm = info.Mode().Perm()
+	}
+
+	// The leading dot and .tmp extension keep the file out of image discovery
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+/*
+checkOutputPath refuses an outputPath that is inputPath itself unless the
+Overwrite option is set. A name template such as "{name}{ext}" without an
+OutputDir would otherwise replace originals without a backup.
+*/
+func (o Options) checkOutputPath(inputPath, outputPath string) error {
+	if !o.Overwrite && filepath.Clean(inputPath) == filepath.Clean(outputPath) {
+		return fmt.Errorf("output %s would replace the input image, which requires overwrite mode", outputPath)
+	}
+	return nil
+}
+
+/*
+BackupPath returns where the Backup option keeps a copy of path before it is
+replaced. Backup names a directory if it contains a path separator or is an
+existing directory, in which the directory tree below InputRoot is mirrored
+like under OutputDir; otherwise it is a suffix appended to the file name. It
+returns an empty string if Backup is unset.
+*/
+func (o Options) BackupPath(path string) string {
+	switch {
+	case o.Backup == "":
+		return ""
+	case isBackupDir(o.Backup):
+		return filepath.Join(o.Backup, o.relativeDir(path), filepath.Base(path))
+	default:
+		return path + o.Backup
+	}
+}
+
+// isBackupDir reports whether a Backup value names a directory rather than a suffix.
+func isBackupDir(backup string) bool {
+	if strings.ContainsRune(backup, '/') || strings.ContainsRune(backup, filepath.Separator) {
+		return true
+	}
+	info, err := os.Stat(backup)
+	return err == nil && info.IsDir()
+}
+
+/*
+backupFile keeps a copy of the existing file at path according to the Backup
+option and returns where it was stored, or "" if there was nothing to back up.
+An existing backup is never replaced, so repeated runs keep the first original.
+*/
+func (r *Resizer) backupFile(path string) (string, error) {
+	backup := r.opts.BackupPath(path)
+	if backup == "" {
+		return "", nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if _, err := os.Stat(backup); err == nil {
+		return backup, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(backup), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	// A hard link is instant; fall back to copying across file systems
+	if err := os.Link(path, backup); err != nil {
+		if err := copyFile(path, backup); err != nil {
+			return "", fmt.Errorf("failed to back up %s: %v", path, err)
+		}
+	}
+	return backup, nil
+}
+
+// copyFile copies the contents and permissions of src to a new file dst.
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src) // #nosec G304 -- copying the user-specified input is intended
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	// #nosec G304 -- the backup location is chosen by the user
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(dst)
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,177 @@
+package resize
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.png")
+
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatalf("Failed to create existing file: %v", err)
+	}
+	if err := writeAtomic(path, []byte("new")); err != nil {
+		t.Fatalf("writeAtomic() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("File content = %q (err %v), want %q", data, err, "new")
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("File mode = %v (err %v), want the replaced file's 0600", info.Mode().Perm(), err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected only the output file to remain, got %v (err %v)", entries, err)
+	}
+}
+
+func TestWriteAtomicFailureKeepsExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	// A directory cannot be replaced by renaming a file over it
+	path := filepath.Join(dir, "out.png")
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	if err := writeAtomic(path, []byte("new")); err == nil {
+		t.Fatal("writeAtomic() expected an error")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be removed, got %v (err %v)", entries, err)
+	}
+}
+
+func TestOptionsBackupPath(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name      string
+		backup    string
+		inputRoot string
+		want      string
+	}{
+		{"unset", "", "", ""},
+		{"suffix", ".bak", "", filepath.Join("photos", "a.jpg.bak")},
+		{"directory with separator", "originals/", "", filepath.Join("originals", "a.jpg")},
+		{"existing directory", dir, "", filepath.Join(dir, "a.jpg")},
+		{"directory mirrors input root", "originals/", ".", filepath.Join("originals", "photos", "a.jpg")},
+		{"suffix ignores input root", ".bak", ".", filepath.Join("photos", "a.jpg.bak")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Options{Backup: tt.backup, InputRoot: tt.inputRoot}
+			if got := o.BackupPath(filepath.Join("photos", "a.jpg")); got != tt.want {
+				t.Errorf("BackupPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResizeFileOverwriteBackup(t *testing.T) {
+	tests := []struct {
+		name       string
+		backup     func(dir string) string
+		wantBackup func(dir string) string
+	}{
+		{
+			name:       "suffix",
+			backup:     func(string) string { return ".orig" },
+			wantBackup: func(dir string) string { return filepath.Join(dir, "photo.png.orig") },
+		},
+		{
+			name:       "directory",
+			backup:     func(dir string) string { return filepath.Join(dir, "originals") + "/" },
+			wantBackup: func(dir string) string { return filepath.Join(dir, "originals", "photo.png") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "photo.png")
+			writeTestPNG(t, input, 80, 60)
+			original, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatalf("Failed to read input: %v", err)
+			}
+
+			r, err := New(Options{Width: 40, Overwrite: true, Backup: tt.backup(dir)})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			for range 2 {
+				result, err := r.ResizeFile(context.Background(), input, "")
+				if err != nil {
+					t.Fatalf("ResizeFile() error = %v", err)
+				}
+				if filepath.Clean(result.BackupPath) != tt.wantBackup(dir) {
+					t.Errorf("BackupPath = %q, want %q", result.BackupPath, tt.wantBackup(dir))
+				}
+			}
+
+			// The second run must not replace the backup with the resized file
+			backup, err := os.ReadFile(tt.wantBackup(dir))
+			if err != nil || !bytes.Equal(backup, original) {
+				t.Errorf("Backup does not hold the original (err %v)", err)
+			}
+			if w, _ := decodeSize(t, input); w != 40 {
+				t.Errorf("Overwritten width = %d, want 40", w)
+			}
+		})
+	}
+}
+
+func TestNewRejectsBackupWithoutOverwrite(t *testing.T) {
+	_, err := New(Options{Width: 40, Backup: ".bak"})
+	if err == nil || !strings.Contains(err.Error(), "backup requires overwrite") {
+		t.Errorf("New() error = %v, want backup requires overwrite", err)
+	}
+}
+
+func TestResizeFileRefusesToReplaceInput(t *testing.T) {
+	dir := t.TempDir()
+	inputPath := filepath.Join(dir, "photo.png")
+	writeTestPNG(t, inputPath, 400, 300)
+	original, err := os.ReadFile(inputPath)
+	if err != nil {
+		t.Fatalf("Failed to read input: %v", err)
+	}
+
+	// Without OutputDir the template names the input itself
+	r, err := New(Options{Width: 100, NameTemplate: "{name}{ext}"})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if _, err := r.ResizeFile(context.Background(), inputPath, ""); err == nil {
+		t.Error("ResizeFile() with the input as output: expected error")
+	}
+	if _, err := r.ResizeFile(context.Background(), inputPath, filepath.Join(dir, ".", "photo.png")); err == nil {
+		t.Error("ResizeFile() with an explicit output equal to the input: expected error")
+	}
+	if _, err := r.Plan(inputPath); err == nil {
+		t.Error("Plan() with the input as output: expected error")
+	}
+	if data, err := os.ReadFile(inputPath); err != nil || !bytes.Equal(data, original) {
+		t.Fatalf("input was modified: %v", err)
+	}
+
+	// With Overwrite replacing the input is what was asked for
+	r, err = New(Options{Width: 100, Overwrite: true})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if _, err := r.ResizeFile(context.Background(), inputPath, ""); err != nil {
+		t.Errorf("ResizeFile() with Overwrite returned error: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/appleboy/com/file"
+	"github.com/appleboy/resize-tool/resize"
+)
+
+// stdinArg is the input argument that reads the image from stdin.
+const stdinArg = "-"
+
+/*
+validateStream checks the flags that do not fit a "-" input or --stdout: the
+image is streamed through memory, so there is exactly one input, one output,
+and no file around it to skip, back up or report on.
+*/
+func validateStream(args []string) error {
+	fromStdin := slices.Contains(args, stdinArg)
+	if !fromStdin && !toStdout {
+		return nil
+	}
+
+	switch {
+	case fromStdin && !toStdout:
+		return errors.New("reading the image from stdin (-) requires --stdout")
+	case len(args) != 1:
+		return errors.New("--stdout and - take exactly one input image")
+	case batchMode:
+		return errors.New("cannot use --stdout with --batch")
+	case len(sizes) > 1:
+		return errors.New("cannot use --stdout with more than one size in --sizes")
+	case overwrite || backup != "":
+		return errors.New("cannot use --stdout with --overwrite or --backup")
+	case outputDir != "":
+		return errors.New("cannot use --stdout with --output")
+	case reportPath != "":
+		return errors.New("cannot use --stdout with --report")
+	case dryRun || skipExisting || incremental:
+		return errors.New("cannot use --stdout with --dry-run, --skip-existing or --incremental")
+	}
+	return nil
+}
+
+/*
+resizeStream implements "-" and --stdout: the image is read from stdin (or
+inputPath), its format detected from the content, and the result written to
+stdout in one piece once it is fully encoded. Nothing else is written to
+stdout; with --verbose the result is described on stderr. An image left alone
+by a size guard is passed through unchanged, or converted at its own size if
+--format asks for another format, so the pipeline still receives an image.
+*/
+func resizeStream(ctx context.Context, inputPath string) error {
+	// A single --sizes entry is just another way of setting the width and height
+	opts := resizeOptions()
+	if len(opts.Sizes) == 1 {
+		opts.Width, opts.Height = opts.Sizes[0].Width, opts.Sizes[0].Height
+		opts.Sizes = nil
+	}
+	resizer, err := resize.New(opts)
+	if err != nil {
+		return err
+	}
+
+	in, name := io.Reader(os.Stdin), "stdin"
+	if inputPath != stdinArg {
+		name = inputPath
+		f, err := os.Open(inputPath) // #nosec G304 -- reading user-specified input is the purpose of the tool
+		if err != nil {
+			return fmt.Errorf("failed to open image %s: %v", inputPath, err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	// Keep what Resize reads, to pass the input through if it is left alone
+	var original bytes.Buffer
+	result, err := resizer.Resize(ctx, io.TeeReader(in, &original), os.Stdout)
+	if errors.Is(err, resize.ErrWithinBounds) {
+		if passThrough(original.Bytes()) {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "Skipped %s: %v, passing the input through unchanged\n", name, err)
+			}
+			_, err = os.Stdout.Write(original.Bytes())
+			return err
+		}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Skipped resizing %s: %v, converting it at its own size\n", name, err)
+		}
+		result, err = convertStream(ctx, opts, original.Bytes())
+	}
+	if err != nil {
+		return err
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Resized %s: %dx%d -> %dx%d (%s)\n",
+			name, result.OriginalWidth, result.OriginalHeight,
+			result.Width, result.Height, result.Format)
+		fmt.Fprintf(os.Stderr, "File size: %s -> %s\n",
+			file.FormatSize(result.InputSize), file.FormatSize(result.OutputSize))
+	}
+	return nil
+}
+
+// passThrough reports whether data can be written out unchanged, i.e. no other format was requested.
+func passThrough(data []byte) bool {
+	if format == "" {
+		return true
+	}
+	detected, err := resize.DetectFormat(data)
+	return err == nil && detected == resize.Format(format)
+}
+
+/*
+convertStream re-encodes data to stdout in the --format output format without
+changing its size, for images a size guard left alone.
+*/
+func convertStream(ctx context.Context, opts resize.Options, data []byte) (*resize.Result, error) {
+	opts.Width, opts.Height, opts.Sizes = 0, 0, nil
+	opts.Scale, opts.MaxSize, opts.MinSize = 1, 0, 0
+	opts.NoUpscale, opts.OnlyEnlarge, opts.OnlyShrinkLargerThan = false, false, resize.Size{}
+	resizer, err := resize.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	return resizer.Resize(ctx, bytes.NewReader(data), os.Stdout)
+}
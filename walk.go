@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+/*
+walker collects the image files below a batch directory. The --include,
+--exclude, --max-depth, --skip-hidden and --follow-symlinks options are applied
+while walking, so excluded directories are pruned instead of being read.
+*/
+type walker struct {
+	root    string   // Batch directory; patterns match paths relative to it
+	files   []string // Image files found so far
+	visited []string // Real paths of the trees walked so far, to detect symlink loops
+}
+
+/*
+walk walks dir, which is reached as logical below the root (they differ inside
+followed symlinks) at the given number of directory levels below it.
+*/
+func (w *walker) walk(dir, logical string, depth int) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			// The walk root itself, which may also be a single file
+			if !d.IsDir() && isImageInput(p) {
+				w.files = append(w.files, logical)
+			}
+			return nil
+		}
+		name := filepath.Join(logical, rel)
+		level := depth + strings.Count(rel, string(filepath.Separator)) + 1
+
+		if w.excluded(name, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case d.Type()&fs.ModeSymlink != 0 && followSymlinks:
+			return w.follow(p, name, level)
+		case d.IsDir():
+			if maxDepth >= 0 && level > maxDepth {
+				return filepath.SkipDir
+			}
+		case w.included(name) && isImageInput(p):
+			w.files = append(w.files, name)
+		}
+		return nil
+	})
+}
+
+/*
+follow handles a symbolic link found at p (reached as name): a link to a file
+is collected like any other file, and a link to a directory is walked unless
+that directory is already part of the walk, which would loop or find the same
+files twice.
+*/
+func (w *walker) follow(p, name string, level int) error {
+	target, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		if verbose {
+			fmt.Printf("Skipping broken symlink: %s\n", name)
+		}
+		return nil
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil
+	}
+
+	if !info.IsDir() {
+		if w.included(name) && isImageInput(name) {
+			w.files = append(w.files, name)
+		}
+		return nil
+	}
+	if maxDepth >= 0 && level > maxDepth {
+		return nil
+	}
+	for _, v := range w.visited {
+		if isWithin(v, target) || isWithin(target, v) {
+			if verbose {
+				fmt.Printf("Skipping symlink loop: %s -> %s\n", name, target)
+			}
+			return nil
+		}
+	}
+	w.visited = append(w.visited, target)
+	return w.walk(target, name, level)
+}
+
+// excluded reports whether an entry is left out by --skip-hidden or --exclude.
+func (w *walker) excluded(name string, d fs.DirEntry) bool {
+	if skipHidden && strings.HasPrefix(d.Name(), ".") {
+		return true
+	}
+	return matchesAny(excludes, w.rel(name))
+}
+
+// included reports whether a file passes --include (every file does without it).
+func (w *walker) included(name string) bool {
+	return len(includes) == 0 || matchesAny(includes, w.rel(name))
+}
+
+// rel returns name relative to the walk root, slash-separated for matching.
+func (w *walker) rel(name string) string {
+	rel, err := filepath.Rel(w.root, name)
+	if err != nil {
+		return filepath.ToSlash(name)
+	}
+	return filepath.ToSlash(rel)
+}
+
+/*
+matchesAny reports whether one of patterns matches rel, a slash-separated
+path. Patterns without a slash match the last path element (so "*.png" or
+"node_modules" match at any depth), the others the whole relative path. They
+are doublestar patterns, so "**" matches any number of directories and
+"{jpg,png}" either alternative.
+*/
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		target := rel
+		if !strings.Contains(pattern, "/") {
+			target = path.Base(rel)
+		}
+		if ok, _ := doublestar.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}